@@ -18,26 +18,52 @@
 compile_error!("no target languages selected (select at least one \"translations-XXX\" feature)");
 
 use jmdict_enums::*;
+use jmdict_traverse::index::{
+    frequency_score, is_kanji, priority_rank, sort_by_frequency, IndexBuilder,
+};
 use std::convert::TryInto;
 use std::io::Write;
 
 fn main() {
     println!("cargo:rerun-if-changed=build.rs");
+    println!("cargo:rerun-if-env-changed=RUST_JMDICT_ENTRYPACK");
+
+    //LanguageSet is a u32 bitset and LANGUAGE_ENTRY_COUNTS has 32 slots, both indexed by
+    //GlossLanguage::to_u32(), so there is only room for 32 enabled languages
+    let language_count = GlossLanguage::all_variants().len();
+    assert!(
+        language_count <= 32,
+        "at most 32 translations-XXX features can be enabled at once, but {} are",
+        language_count
+    );
 
     let opts = jmdict_traverse::Options {
         is_db_minimal: cfg!(feature = "db-minimal"),
         with_uncommon: cfg!(feature = "scope-uncommon"),
         with_archaic: cfg!(feature = "scope-archaic"),
+        on_error: jmdict_traverse::ErrorPolicy::Fail,
     };
 
     let mut omni: OmniBuffer = Default::default();
     if cfg!(not(feature = "db-empty")) {
-        jmdict_traverse::process_dictionary(&mut omni, opts);
+        jmdict_traverse::process_dictionary(&mut omni, opts)
+            .unwrap_or_else(|err| panic!("cannot load JMdict: {}", err));
     }
 
     write_u32s(&path_to("entry_offsets.dat"), &omni.entry_offsets);
-    write_u32s(&path_to("payload.dat"), &omni.data);
-    std::fs::write(&path_to("strings.txt"), &omni.text).unwrap();
+    let data: Vec<u8> = omni.data.iter().flat_map(|val| val.to_ne_bytes()).collect();
+    write_payload("payload.dat", &data);
+    write_payload("strings.txt", omni.text.as_bytes());
+    write_pos_combinations(&path_to("pos_combinations.rs"), &omni.pos_combinations);
+    write_entry_counts(&path_to("entry_counts.rs"), &omni);
+    write_pack_info(&path_to("pack_info.rs"), &omni);
+    if cfg!(feature = "index-kanji") {
+        write_index("kanji_index", &omni.kanji_index);
+    }
+    if cfg!(feature = "index-frequency") {
+        let order = sort_by_frequency(omni.frequency_scores);
+        write_u32s(&path_to("frequency_order.dat"), &order);
+    }
 }
 
 fn path_to(filename: &str) -> std::path::PathBuf {
@@ -53,6 +79,65 @@ fn write_u32s(path: &std::path::Path, vals: &[u32]) {
     }
 }
 
+//With the "compressed-embed" feature, the two large data files are gzipped here and unpacked on
+//first access (see src/payload.rs).
+fn write_payload(filename: &str, contents: &[u8]) {
+    if cfg!(feature = "compressed-embed") {
+        let f = std::fs::File::create(&path_to(&format!("{}.gz", filename))).unwrap();
+        let mut enc = libflate::gzip::Encoder::new(std::io::BufWriter::new(f)).unwrap();
+        enc.write_all(contents).unwrap();
+        enc.finish().into_result().unwrap().flush().unwrap();
+    } else {
+        std::fs::write(&path_to(filename), contents).unwrap();
+    }
+}
+
+//Unlike the other data files, this one is Rust code since we want to hand out `&[PartOfSpeech]`
+//slices, which we cannot reinterpret from the u32 payload.
+fn write_pos_combinations(path: &std::path::Path, combinations: &[Vec<PartOfSpeech>]) {
+    let mut lines = vec!["pub(crate) static ALL_POS_COMBINATIONS: &[&[PartOfSpeech]] = &[".into()];
+    for combination in combinations {
+        let names: Vec<_> = combination
+            .iter()
+            .map(|pos| format!("PartOfSpeech::{}", pos.constant_name()))
+            .collect();
+        lines.push(format!("    &[{}],", names.join(", ")));
+    }
+    lines.push("];\n".into());
+    std::fs::write(&path, lines.join("\n")).unwrap();
+}
+
+//Precomputed results for src/stats.rs, as Rust code for the same reason as above.
+fn write_entry_counts(path: &std::path::Path, omni: &OmniBuffer) {
+    let counts: Vec<_> = omni
+        .language_entry_counts
+        .iter()
+        .map(|c| c.to_string())
+        .collect();
+    let code = format!(
+        "pub(crate) static COMMON_ENTRY_COUNT: usize = {};\npub(crate) static LANGUAGE_ENTRY_COUNTS: [usize; 32] = [{}];\n",
+        omni.common_entry_count,
+        counts.join(", "),
+    );
+    std::fs::write(&path, code).unwrap();
+}
+
+fn write_pack_info(path: &std::path::Path, omni: &OmniBuffer) {
+    let code = format!(
+        "pub(crate) static JMDICT_DATE: Option<&str> = {:?};\n",
+        omni.jmdict_date
+    );
+    std::fs::write(&path, code).unwrap();
+}
+
+//Inverted indexes are written as two files `{name}_keys.dat` and `{name}_values.dat`. See
+//jmdict_traverse::index::IndexBuilder::encode() for the format.
+fn write_index(name: &str, index: &IndexBuilder) {
+    let (keys, values) = index.encode();
+    write_u32s(&path_to(&format!("{}_keys.dat", name)), &keys);
+    write_u32s(&path_to(&format!("{}_values.dat", name)), &values);
+}
+
 ///Helper type for references into OmniBuffer::data or OmniBuffer::text.
 ///Gets constructed as `(start, end).into()` in the respective OmniBuffer methods.
 struct StoredRef {
@@ -76,6 +161,17 @@ struct OmniBuffer {
     entry_offsets: Vec<u32>,
     data: Vec<u32>,
     text: String,
+    //distinct values of RawSense::pos, in order of first occurrence
+    pos_combinations: Vec<Vec<PartOfSpeech>>,
+    seen_pos_combinations: std::collections::HashSet<Vec<PartOfSpeech>>,
+    kanji_index: IndexBuilder,
+    //(score, ent_seq, entry index) for each entry, see jmdict_traverse::index::sort_by_frequency()
+    frequency_scores: Vec<(u32, u32, u32)>,
+    //see src/stats.rs; languages are indexed by GlossLanguage::to_u32()
+    common_entry_count: usize,
+    language_entry_counts: [usize; 32],
+    //from the header line of the entrypack, if any
+    jmdict_date: Option<String>,
 }
 
 impl OmniBuffer {
@@ -122,6 +218,17 @@ impl OmniBuffer {
 impl jmdict_traverse::Visitor for OmniBuffer {
     fn notify_data_file_path(&mut self, path: &str) {
         println!("cargo:rerun-if-changed={}", &path);
+        println!("cargo:warning=using JMdict entrypack from {}", &path);
+    }
+
+    fn notify_header(&mut self, header: &jmdict_traverse::PackHeader) {
+        if let Some(date) = &header.jmdict_date {
+            println!(
+                "cargo:warning=entrypack was generated from JMdict created on {}",
+                date
+            );
+        }
+        self.jmdict_date = header.jmdict_date.clone();
     }
 
     fn process_entry(&mut self, entry: &jmdict_traverse::RawEntry) {
@@ -129,7 +236,43 @@ impl jmdict_traverse::Visitor for OmniBuffer {
         let mut repr = vec![0u32; size];
         entry.encode_one(self, &mut repr);
         let r = self.push_data(&repr);
+        let entry_idx = self.entry_offsets.len().try_into().unwrap();
         self.entry_offsets.push(r.start);
+
+        if cfg!(feature = "index-kanji") {
+            for k_ele in &entry.k_ele {
+                let rank = priority_rank(k_ele.ke_pri);
+                for c in k_ele.keb.chars().filter(|&c| is_kanji(c)) {
+                    self.kanji_index.insert(c as u32, rank, entry_idx);
+                }
+            }
+        }
+
+        if cfg!(feature = "index-frequency") {
+            let ke_pris = entry.k_ele.iter().map(|k| k.ke_pri);
+            let re_pris = entry.r_ele.iter().map(|r| r.re_pri);
+            let score = ke_pris.chain(re_pris).map(frequency_score).min().unwrap();
+            self.frequency_scores
+                .push((score, entry.ent_seq, entry_idx));
+        }
+
+        let ke_pris = entry.k_ele.iter().map(|k| k.ke_pri);
+        let re_pris = entry.r_ele.iter().map(|r| r.re_pri);
+        if ke_pris.chain(re_pris).any(|p| p.is_common()) {
+            self.common_entry_count += 1;
+        }
+        let languages = language_bitset(entry);
+        for (idx, count) in self.language_entry_counts.iter_mut().enumerate() {
+            if languages & (1 << idx) != 0 {
+                *count += 1;
+            }
+        }
+
+        for sense in &entry.sense {
+            if !sense.pos.is_empty() && self.seen_pos_combinations.insert(sense.pos.clone()) {
+                self.pos_combinations.push(sense.pos.clone());
+            }
+        }
     }
 }
 
@@ -182,7 +325,7 @@ enum_to_payload!(Dialect);
 
 impl ToPayload for jmdict_traverse::RawEntry<'_> {
     fn size() -> usize {
-        4
+        5
     }
 
     fn encode_one(&self, omni: &mut OmniBuffer, buf: &mut [u32]) {
@@ -204,9 +347,19 @@ impl ToPayload for jmdict_traverse::RawEntry<'_> {
         buf[1] = r.end;
         buf[2] = offset1 + (offset2 << 16);
         buf[3] = self.ent_seq;
+        //bitset of gloss languages, for Entry::available_languages()
+        buf[4] = language_bitset(self);
     }
 }
 
+fn language_bitset(entry: &jmdict_traverse::RawEntry) -> u32 {
+    entry
+        .sense
+        .iter()
+        .flat_map(|s| s.gloss.iter())
+        .fold(0, |bits, g| bits | (1 << g.lang.to_u32()))
+}
+
 impl ToPayload for jmdict_traverse::RawKanjiElement<'_> {
     fn size() -> usize {
         5
@@ -225,7 +378,7 @@ impl ToPayload for jmdict_traverse::RawKanjiElement<'_> {
 
 impl ToPayload for jmdict_traverse::RawReadingElement<'_> {
     fn size() -> usize {
-        5
+        6
     }
 
     fn encode_one(&self, omni: &mut OmniBuffer, buf: &mut [u32]) {
@@ -233,9 +386,16 @@ impl ToPayload for jmdict_traverse::RawReadingElement<'_> {
         let r = omni.push_str(self.reb);
         buf[1] = r.start;
         buf[2] = r.end;
-        let r = omni.push_array(&self.re_inf);
+
+        //same approach as for RawSense: concatenate re_inf and re_restr and store the offset
+        //between them, with the re_nokanji flag in the high bit
+        let mut dbuf = Vec::new();
+        let offset1 = push_array(&mut dbuf, omni, &self.re_inf);
+        push_array(&mut dbuf, omni, &self.re_restr);
+        let r = omni.push_data(&dbuf);
         buf[3] = r.start;
         buf[4] = r.end;
+        buf[5] = offset1 | if self.re_nokanji { 0x80000000 } else { 0 };
     }
 }
 
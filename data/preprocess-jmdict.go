@@ -9,33 +9,374 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"flag"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	inputURL               = flag.String("url", "", "download the JMdict from this URL instead of reading it from a file")
+	inputURLTimeout        = flag.Duration("url-timeout", 5*time.Minute, "with -url, abort the download after this time")
+	inputSHA256            = flag.String("sha256", "", "abort unless the input (before decompression) has this SHA-256 checksum (hex-encoded)")
+	diffMode               = flag.Bool("diff", false, "instead of preprocessing, compare two entrypack.json files and report changed entries")
+	checkSum               = flag.String("check-sum", "", "instead of preprocessing, check the file listed in this checksum file (as written by -write-sha256)")
+	writeSHA256            = flag.Bool("write-sha256", false, "write the SHA-256 checksum of the output into a file with the same name plus \".sha256\", in the format of sha256sum")
+	verifyMode             = flag.Bool("verify", false, "instead of preprocessing, check an entrypack.json for consistency and print a summary")
+	diffAsJSON             = flag.Bool("diff-json", false, "with -diff, print the report as JSON instead of text")
+	maxEntryBytes          = flag.Int("max-entry-bytes", 1<<20, "abort when a single <entry> is larger than this many bytes, e.g. because of a missing </entry> (0 = no limit)")
+	emitSchema             = flag.Bool("emit-schema", false, "write a JSON Schema describing the entries in entrypack.json into entrypack.schema.json")
+	transformNames         = flag.String("transform", "", "comma-separated list of transforms to apply to each entry (see README.md)")
+	minPriority            = flag.Int("min-priority", 0, "drop entries without any kanji or reading element marked news1, ichi1, spec1, gai1 or nfXX with XX <= this value (0 = keep all entries)")
+	glossLanguages         = flag.String("langs", "", "comma-separated list of gloss languages to keep, e.g. \"eng,dut\" (default: keep all languages)")
+	mergeGlosses           = flag.String("merge-glosses", "", "comma-separated list of LANG:FILE pairs; for each, add the glosses in FILE as additional senses in language LANG (see README.md)")
+	seqMin                 = flag.Uint64("seq-min", 0, "drop all entries with a sequence number below this value (0 = no limit)")
+	seqMax                 = flag.Uint64("seq-max", 0, "drop all entries with a sequence number above this value (0 = no limit)")
+	posFilter              = flag.String("pos", "", "comma-separated list of part-of-speech codes like \"v1,v5k\"; drop all entries without a sense that has at least one of them")
+	onlySeqNos             = flag.String("only-seqs", "", "drop all entries whose sequence numbers are not listed in this file (one per line)")
+	selfCheck              = flag.Bool("self-check", false, "check that each entry decodes from the generated JSON into the same value as from the XML")
+	verboseKeys            = flag.Bool("verbose-keys", false, "use descriptive keys like \"readings\" instead of single letters in the JSON output (not supported by the jmdict crate)")
+	prettyDebug            = flag.Bool("pretty-debug", false, "shorthand for -pretty -verbose-keys that also replaces entity names like \"arch\" with their definitions like \"archaic\" (not supported by the jmdict crate)")
+	prettyPrint            = flag.Bool("pretty", false, "indent each entry in entrypack.json for debugging, and separate entries by blank lines (not supported by the jmdict crate)")
+	outputFormat           = flag.String("format", "ndjson", "output format for entrypack.json: \"ndjson\" (one entry per line), \"json-array\" or \"tsv-glosses\" (written into entrypack.tsv instead; the latter two are not supported by the jmdict crate)")
+	shardMaxBytes          = flag.Int("shard-max-bytes", 0, "instead of entrypack.json, write entrypack.000.json, entrypack.001.json etc. that are each smaller than this many bytes, and list them in entrypack.shards.json (0 = no sharding)")
+	toXML                  = flag.Bool("to-xml", false, "instead of preprocessing, convert an entrypack.json back into JMdict XML and print it on stdout")
+	entitiesPath           = flag.String("entities", "../jmdict-enums/data/entities.json", "write the entity definitions from the DTD into this file (with -to-xml or -entries-only, read them from this file instead); \"-\" writes to stdout, or to stderr with -out=-")
+	languagesPath          = flag.String("languages", "../jmdict-enums/data/languages.json", "read the gloss languages that the jmdict crate knows about from this file")
+	outputPath             = flag.String("out", "", "write the entrypack into this file instead of entrypack.json (or entrypack.tsv with -format=tsv-glosses); \"-\" writes to stdout")
+	entriesOnly            = flag.Bool("entries-only", false, "read input that only contains <entry> elements without the DTD and <JMdict> wrapper (entity definitions are read from -entities instead)")
+	jmnedict               = flag.Bool("jmnedict", false, "read the JMnedict (names dictionary) instead of the JMdict, and write namepack.json instead of entrypack.json (see README.md)")
+	strictLang             = flag.Bool("strict-lang", false, "fail if any gloss has a language code that the jmdict crate does not know (without this option, unknown codes are only reported on stderr)")
+	reportDuplicateGlosses = flag.Bool("report-duplicate-glosses", false, "report entries where the same gloss text appears in multiple languages (on stderr)")
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s <path-to-JMdict>\n", os.Args[0])
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <path-to-JMdict>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s [options] -url <url-of-JMdict>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s -emit-schema\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s -diff [-diff-json] <old-entrypack.json> <new-entrypack.json>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s -verify <entrypack.json>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s -check-sum <entrypack.json.sha256>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s -to-xml [-entities <entities.json>] <entrypack.json>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *diffMode {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		diffEntrypacks(flag.Arg(0), flag.Arg(1))
+		return
+	}
+	if *checkSum != "" {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		err := checkChecksumFile(*checkSum)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("%s: OK\n", *checkSum)
+		return
+	}
+	if *verifyMode {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		file, err := os.Open(flag.Arg(0))
+		must(err)
+		report, err := verifyEntrypack(file)
+		must(err)
+		file.Close()
+		report.Print(os.Stdout)
+		if len(report.Violations) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *toXML {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *entitiesPath == "-" {
+			fmt.Fprintln(os.Stderr, "-entities=- cannot be combined with -to-xml (it only works when the entity definitions are written)")
+			os.Exit(1)
+		}
+		writeXML(os.Stdout, flag.Arg(0), *entitiesPath)
+		return
+	}
+	if *emitSchema {
+		writeSchema("entrypack.schema.json")
+		if flag.NArg() == 0 && *inputURL == "" {
+			return
+		}
+	}
+	expectedArgs := 1
+	if *inputURL != "" {
+		expectedArgs = 0
+	}
+	if flag.NArg() != expectedArgs {
+		flag.Usage()
+		os.Exit(1)
+	}
+	selectTransforms(*transformNames)
+	knownGlossLanguages = readKnownGlossLanguages(*languagesPath)
+	if *glossLanguages != "" {
+		var err error
+		selectedGlossLanguages, err = parseGlossLanguages(*glossLanguages)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+	if *mergeGlosses != "" {
+		for _, spec := range strings.Split(*mergeGlosses, ",") {
+			lang, path, err := parseMergeGlossesSpec(spec)
+			must(err)
+			file, err := os.Open(path)
+			must(err)
+			supplement, err := readGlossSupplement(lang, file)
+			if err != nil {
+				panic(fmt.Sprintf("cannot read %s: %s", path, err.Error()))
+			}
+			file.Close()
+			glossSupplements = append(glossSupplements, supplement)
+		}
+	}
+	if *posFilter != "" {
+		selectedPartsOfSpeech = parsePartsOfSpeech(*posFilter)
+	}
+	if *seqMax > 0 && *seqMin > *seqMax {
+		fmt.Fprintln(os.Stderr, "-seq-min must not be larger than -seq-max")
+		os.Exit(1)
+	}
+	if *onlySeqNos != "" {
+		file, err := os.Open(*onlySeqNos)
+		must(err)
+		allowedSeqNos, err = readSeqNoAllowList(file)
+		must(err)
+		file.Close()
+	}
+	if *prettyDebug {
+		*prettyPrint = true
+		*verboseKeys = true
+	}
+	if *outputFormat != "ndjson" && *outputFormat != "json-array" && *outputFormat != "tsv-glosses" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %q\n", *outputFormat)
+		os.Exit(1)
+	}
+	if *outputFormat == "tsv-glosses" && (*prettyPrint || *verboseKeys) {
+		fmt.Fprintln(os.Stderr, "-format=tsv-glosses cannot be combined with -pretty or -verbose-keys")
+		os.Exit(1)
+	}
+	if *shardMaxBytes > 0 && *outputFormat != "ndjson" {
+		fmt.Fprintln(os.Stderr, "-shard-max-bytes can only be used with -format=ndjson")
+		os.Exit(1)
+	}
+	if *shardMaxBytes > 0 && *outputPath != "" {
+		fmt.Fprintln(os.Stderr, "-shard-max-bytes cannot be combined with -out")
+		os.Exit(1)
+	}
+	if *shardMaxBytes > 0 && *prettyPrint {
+		fmt.Fprintln(os.Stderr, "-shard-max-bytes cannot be combined with -pretty")
+		os.Exit(1)
+	}
+	if *inputSHA256 != "" && (*outputPath == "-" || *entitiesPath == "-") {
+		//the output can only be held back until the checksum is verified if it goes into files
+		fmt.Fprintln(os.Stderr, "-sha256 cannot be combined with -out=- or -entities=-")
+		os.Exit(1)
+	}
+	if *entriesOnly && *entitiesPath == "-" {
+		fmt.Fprintln(os.Stderr, "-entities=- cannot be combined with -entries-only (it only works when the entity definitions are written)")
 		os.Exit(1)
 	}
+	if *writeSHA256 && (*shardMaxBytes > 0 || *outputPath == "-") {
+		fmt.Fprintln(os.Stderr, "-write-sha256 cannot be combined with -shard-max-bytes or -out=-")
+		os.Exit(1)
+	}
+	if *jmnedict {
+		flagsSet := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
+		for _, name := range jmnedictUnsupportedFlags {
+			if flagsSet[name] {
+				fmt.Fprintf(os.Stderr, "-%s cannot be combined with -jmnedict\n", name)
+				os.Exit(1)
+			}
+		}
+		if *outputFormat == "tsv-glosses" {
+			fmt.Fprintln(os.Stderr, "-format=tsv-glosses cannot be combined with -jmnedict")
+			os.Exit(1)
+		}
+		//the JMnedict entities must not overwrite the JMdict entities that the crate uses
+		if !flagsSet["entities"] {
+			*entitiesPath = "name-entities.json"
+		}
+	}
 
-	//open input file for line-wise reading
-	file, err := os.Open(os.Args[1])
-	must(err)
-	fileBuffered := bufio.NewReaderSize(file, 65536)
+	//open input file (or URL) for line-wise reading
+	var input io.Reader
+	if *inputURL == "" {
+		file, err := os.Open(flag.Arg(0))
+		must(err)
+		defer file.Close()
+		input = file
+	} else {
+		body := openURL(*inputURL, *inputURLTimeout)
+		defer body.Close()
+		input = body
+	}
+	var inputHash hash.Hash
+	if *inputSHA256 != "" {
+		inputHash = sha256.New()
+		input = io.TeeReader(input, inputHash)
+	}
+	fileBuffered := bufio.NewReaderSize(maybeGunzip(input), 65536)
+	lineNo := 0
 	nextLine := func() string {
 		line, err := fileBuffered.ReadString('\n')
+		if err == io.EOF && *entriesOnly {
+			//entry-only input does not have a </JMdict> at the end
+			if line == "" {
+				return "</" + rootElementName() + ">"
+			}
+			err = nil
+		}
+		must(err)
+		lineNo++
+		line, err = checkInputLine(line, lineNo)
 		must(err)
 		return strings.TrimSpace(line)
 	}
 
-	processOpening(nextLine)
-	processEntries(nextLine)
+	var header packHeader
+	if *entriesOnly {
+		header = loadDecoderEntities(*entitiesPath)
+	} else {
+		header = processOpening(nextLine, *entitiesPath)
+	}
+	//-pos can only be checked once the entity definitions are known
+	if err := checkPartsOfSpeech(selectedPartsOfSpeech); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *jmnedict {
+		processNames(nextLine, header, *outputPath)
+	} else {
+		processEntries(nextLine, header, *outputPath)
+	}
+
+	if inputHash != nil {
+		//the checksum covers the entire input, so read whatever is left after </JMdict>
+		_, err := io.Copy(ioutil.Discard, fileBuffered)
+		must(err)
+		_, err = io.Copy(ioutil.Discard, input)
+		must(err)
+		actual := hex.EncodeToString(inputHash.Sum(nil))
+		if !strings.EqualFold(actual, *inputSHA256) {
+			discardStagedOutputs()
+			panic(fmt.Sprintf("checksum mismatch: expected SHA-256 %s, got %s", *inputSHA256, actual))
+		}
+		must(commitStagedOutputs())
+	}
+}
+
+//stagedOutputs contains the paths of all output files that were written by
+//stagedPath() so far.
+var stagedOutputs []string
+
+//stagedPath returns the path where the output file for the given path shall be
+//written. With -sha256, the checksum of the input is only known after all
+//output files have been written. To avoid overwriting a good entrypack with
+//output from a broken download, all output files are written under a temporary
+//name, and only moved to their actual path by commitStagedOutputs() once the
+//checksum has been verified.
+func stagedPath(path string) string {
+	if *inputSHA256 == "" {
+		return path
+	}
+	stagedOutputs = append(stagedOutputs, path)
+	return path + ".tmp"
+}
+
+//commitStagedOutputs moves all files written through stagedPath() to their
+//actual path.
+func commitStagedOutputs() error {
+	for _, path := range stagedOutputs {
+		err := os.Rename(path+".tmp", path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//discardStagedOutputs deletes all files written through stagedPath().
+func discardStagedOutputs() {
+	for _, path := range stagedOutputs {
+		os.Remove(path + ".tmp")
+	}
+}
+
+//checkInputLine strips the byte order mark from the first line of the input,
+//and checks that each line is valid UTF-8. The JMdict is always UTF-8, but
+//mirrored copies are sometimes re-encoded, and the XML decoder would then fail
+//with much less helpful error messages.
+func checkInputLine(line string, lineNo int) (string, error) {
+	if lineNo == 1 {
+		line = strings.TrimPrefix(line, "\uFEFF")
+	}
+	if !utf8.ValidString(line) {
+		return "", fmt.Errorf("line %d of the input is not valid UTF-8 (was the file re-encoded?)", lineNo)
+	}
+	return line, nil
+}
+
+//openURL starts downloading the given URL. The result is streamed instead of
+//being written into a temporary file.
+func openURL(url string, timeout time.Duration) io.ReadCloser {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	must(err)
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		panic(fmt.Sprintf("GET %s returned %s", url, resp.Status))
+	}
+	return resp.Body
+}
+
+//maybeGunzip decompresses the input on the fly if it starts with the gzip magic
+//number, so that both JMdict and JMdict.gz (or JMdict_e.gz) can be given.
+func maybeGunzip(input io.Reader) io.Reader {
+	buffered := bufio.NewReader(input)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(buffered)
+		must(err)
+		return gzipReader
+	}
+	return buffered
 }
 
 func must(err error) {
@@ -52,10 +393,44 @@ var (
 	entityDefRx    = regexp.MustCompile(`^<!ENTITY (\S+) "(.+)">$`)
 )
 
-func processOpening(nextLine func() string) {
+//packHeader is written as the first line of entrypack.json. It can be told
+//apart from the entries because it does not have the "n" key. Older
+//entrypacks do not have a header, so consumers must not rely on it.
+type packHeader struct {
+	Version int `json:"v"`
+	//the features from schemaFeatureRxs that were found in the DTD
+	Schema []string `json:"schema"`
+	//the date from the "JMdict created" comment in the DTD, if any
+	JMdictDate string `json:"jmdict_date,omitempty"`
+}
+
+//isPackHeader reports whether a line from entrypack.json contains the
+//packHeader instead of an entry.
+func isPackHeader(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(`{"v":`))
+}
+
+//jmdictDateRx matches the comment in the DTD that records when the JMdict file
+//was generated, e.g. "<!-- JMdict created: 2023-07-25 -->". The JMnedict has
+//the same comment with "JMnedict" instead.
+var jmdictDateRx = regexp.MustCompile(`^<!-- JM(?:ne)?dict created: (\d{4}-\d{2}-\d{2}) -->$`)
+
+//schemaFeatureRxs detects optional parts of the JMdict DTD that were added over
+//time. Each regex is matched against each line of the DTD.
+var schemaFeatureRxs = map[string]*regexp.Regexp{
+	//<example> elements in <sense> (added in 2021)
+	"examples": regexp.MustCompile(`^<!ELEMENT example\b`),
+	//search-only forms in <ke_inf> and <re_inf> (added in 2023)
+	"search-only-forms": regexp.MustCompile(`^<!ENTITY s[kK] `),
+	//<lsource ls_wasei="y">
+	"wasei": regexp.MustCompile(`^<!ATTLIST lsource ls_wasei\b`),
+}
+
+func processOpening(nextLine func() string, entitiesPath string) packHeader {
 	var (
 		sets       = make(map[string]map[string]string)
 		currentSet = ""
+		header     = packHeader{Version: 1, Schema: []string{}}
 	)
 
 	for {
@@ -63,7 +438,7 @@ func processOpening(nextLine func() string) {
 
 		//This loop sees all the lines of the DTD up to the opener of the actual
 		//document contents.
-		if line == "<JMdict>" {
+		if line == "<"+rootElementName()+">" {
 			break
 		}
 
@@ -87,45 +462,571 @@ func processOpening(nextLine func() string) {
 			//"&arch;" expands into "arch" rather than "archaism")
 			decoderEntities[key] = key
 		}
+
+		match = jmdictDateRx.FindStringSubmatch(line)
+		if match != nil {
+			header.JMdictDate = match[1]
+		}
+
+		for feature, rx := range schemaFeatureRxs {
+			if rx.MatchString(line) && !containsString(header.Schema, feature) {
+				header.Schema = append(header.Schema, feature)
+			}
+		}
 	}
+	sort.Strings(header.Schema)
+	entitySets = sets
 
 	//dump collected data
-	buf, err := json.Marshal(sets)
+	buf, err := marshalEntitySets(sets)
 	must(err)
+	switch {
+	case entitiesPath != "-":
+		must(ioutil.WriteFile(stagedPath(entitiesPath), buf, 0666))
+	case *outputPath == "-":
+		//stdout is taken by the entrypack
+		_, err = os.Stderr.Write(buf)
+		must(err)
+	default:
+		_, err = os.Stdout.Write(buf)
+		must(err)
+	}
+	return header
+}
+
+//marshalEntitySets renders the contents of entities.json. The output only
+//depends on the contents of the sets, not on the order in which they were
+//read: the sets and the entities in each set are copied into slices sorted by
+//name before marshaling. This keeps the diff of entities.json small when the
+//JMdict is updated.
+func marshalEntitySets(sets map[string]map[string]string) ([]byte, error) {
+	var obj orderedObject
+	for _, setName := range sortedKeys(sets) {
+		var setObj orderedObject
+		for _, key := range sortedKeys(sets[setName]) {
+			setObj = append(setObj, orderedMember{key, sets[setName][key]})
+		}
+		obj = append(obj, orderedMember{setName, setObj})
+	}
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
 	var indented bytes.Buffer
-	must(json.Indent(&indented, buf, "", "\t"))
-	must(ioutil.WriteFile("../jmdict-enums/data/entities.json", indented.Bytes(), 0666))
+	err = json.Indent(&indented, buf, "", "\t")
+	return indented.Bytes(), err
+}
+
+//orderedObject is a JSON object whose members are marshaled in the order of
+//this slice.
+type orderedObject []orderedMember
+
+type orderedMember struct {
+	Key   string
+	Value interface{}
+}
+
+//MarshalJSON implements the json.Marshaler interface.
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for idx, member := range o {
+		if idx > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+//loadDecoderEntities is used instead of processOpening() with -entries-only. It
+//reads the entity definitions from an entities.json file written by
+//processOpening() earlier. The schema features cannot be detected without the
+//DTD, so the header does not list any.
+func loadDecoderEntities(entitiesPath string) packHeader {
+	entitySets = readEntitySets(entitiesPath)
+	for _, set := range entitySets {
+		for key := range set {
+			decoderEntities[key] = key
+		}
+	}
+	return packHeader{Version: 1, Schema: []string{}}
+}
+
+//readEntitySets reads an entities.json file as written by processOpening().
+func readEntitySets(path string) map[string]map[string]string {
+	buf, err := ioutil.ReadFile(path)
+	must(err)
+	var sets map[string]map[string]string
+	must(json.Unmarshal(buf, &sets))
+	return sets
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // process contents (everything between <JMdict> and </JMdict>)
 
-func processEntries(nextLine func() string) {
-	outputFile, err := os.Create("entrypack.json")
+var entSeqRx = regexp.MustCompile(`<ent_seq>(\d+)</ent_seq>`)
+
+//processEntries writes the entrypack into outputPath. If outputPath is empty,
+//the default file name for the selected -format is used. If outputPath is "-",
+//the entrypack is written to stdout.
+func processEntries(nextLine func() string, header packHeader, outputPath string) {
+	var (
+		output   entryWriter
+		shards   *shardWriter
+		checksum hash.Hash //only with -write-sha256
+	)
+	if *shardMaxBytes > 0 {
+		shards = &shardWriter{Dir: ".", MaxBytes: *shardMaxBytes}
+	} else {
+		if outputPath == "" {
+			outputPath = "entrypack.json"
+			if *outputFormat == "tsv-glosses" {
+				outputPath = "entrypack.tsv"
+			}
+		}
+		var outputFile io.Writer = os.Stdout
+		if outputPath != "-" {
+			file, err := os.Create(stagedPath(outputPath))
+			must(err)
+			defer file.Close()
+			outputFile = file
+		}
+		if *writeSHA256 {
+			checksum = sha256.New()
+			outputFile = io.MultiWriter(outputFile, checksum)
+		}
+		output = entryWriter{
+			Writer:   outputFile,
+			AsArray:  *outputFormat == "json-array",
+			GlossTSV: *outputFormat == "tsv-glosses",
+			Pretty:   *prettyPrint,
+		}
+		must(output.Begin())
+	}
+
+	headerBytes, err := json.Marshal(header)
 	must(err)
-	defer outputFile.Close()
+	if shards != nil {
+		must(shards.WriteHeader(string(headerBytes) + "\n"))
+	} else if !output.GlossTSV {
+		//the TSV has no place for the header line
+		must(output.Write(string(headerBytes) + "\n"))
+	}
 
-	buf := ""
+	entries := newEntryDecoder(nextLine)
 	for {
-		line := nextLine()
-
 		//This loop ends when we encounter the end of the file.
-		if line == "</JMdict>" {
-			if buf != "" {
-				//we should have had </entry> just before and thus have an empty buffer
-				panic("reached </JMdict> with non-empty buffer: " + buf)
+		var e dictEntry
+		ok, err := entries.Next(&e)
+		if ok && err == nil {
+			err = validateEntry(e)
+		}
+		if err != nil {
+			panic(describeEntryError(entries.Count, entries.Snippet(), err))
+		}
+		if !ok {
+			if shards != nil {
+				must(shards.Finish())
+			} else {
+				must(output.Finish())
+			}
+			if checksum != nil {
+				must(writeChecksumFile(outputPath, checksum.Sum(nil)))
+			}
+			if *minPriority > 0 {
+				fmt.Fprintf(os.Stderr, "dropped %d entries below -min-priority=%d\n", droppedByMinPriority, *minPriority)
+			}
+			if allowedSeqNos != nil {
+				reportMissingAllowedSeqNos(os.Stderr)
+			}
+			for _, supplement := range glossSupplements {
+				supplement.reportUnused(os.Stderr)
+			}
+			reportUnknownGlossLanguages(os.Stderr)
+			reportUnknownEntities(os.Stderr)
+			if *strictLang && len(unknownGlossLanguages) > 0 {
+				//the output files have already been written at this point, but a
+				//failing exit code is enough to stop automated pipelines
+				panic("found glosses in unknown languages (see above)")
+			}
+			if len(unknownEntities) > 0 {
+				//jmdict-enums cannot be built when entities.json is missing any of these
+				panic("found values without entity definitions (see above)")
 			}
 			break
 		}
 
-		//Collect lines until we have a full entry to process.
-		buf += line
-		if line == "</entry>" {
-			_, err := outputFile.Write([]byte(processEntry(buf)))
-			must(err)
-			buf = ""
+		if !prepareEntry(&e) {
+			continue
+		}
+		if output.GlossTSV {
+			must(output.WriteGlossRows(e))
+			continue
+		}
+		jsonStr, err := encodeEntry(e)
+		if err != nil {
+			panic(describeEntryError(entries.Count, entries.Snippet(), err))
+		}
+		if shards != nil {
+			must(shards.Write(e.SeqNo, jsonStr))
+		} else {
+			must(output.Write(jsonStr))
+		}
+	}
+}
+
+//entryDecoder reads the <entry> elements of the JMdict (or JMnedict) from a
+//single xml.Decoder for processEntries() and processNames().
+type entryDecoder struct {
+	input *lineReader
+	dec   *xml.Decoder
+	//the number of entries read so far, including the current one
+	Count int
+	//the ent_seq of the last entry that was decoded without errors
+	lastSeqNo string
+}
+
+func newEntryDecoder(nextLine func() string) *entryDecoder {
+	//The opener of the root element has already been consumed by
+	//processOpening() (or does not exist with -entries-only), so it is put back
+	//in front of the stream.
+	input := &lineReader{nextLine: nextLine, line: "<" + rootElementName() + ">"}
+	dec := xml.NewDecoder(input)
+	dec.Entity = decoderEntities
+	return &entryDecoder{input: input, dec: dec, lastSeqNo: "none"}
+}
+
+//Next decodes the next <entry> into target. It returns false when the end of
+//the root element is reached. Errors in the XML outside of entries are fatal,
+//but errors within an entry are returned, so that the caller can report them
+//with describeEntryError().
+func (d *entryDecoder) Next(target interface{}) (bool, error) {
+	for {
+		token, err := d.dec.Token()
+		if err != nil {
+			panic(fmt.Sprintf("after entry #%d: %s", d.Count, err.Error()))
+		}
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == rootElementName() {
+			return false, nil
+		}
+
+		//Everything besides <entry> elements (e.g. comments) is skipped.
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local == rootElementName() {
+			continue
+		}
+		if start.Name.Local != "entry" {
+			panic(fmt.Sprintf("after entry #%d: unexpected element <%s>", d.Count, start.Name.Local))
+		}
+		d.Count++
+		//The size limit is enforced by the lineReader, so that an entry with a
+		//missing </entry> fails early instead of being decoded until EOF.
+		d.input.Mark(*maxEntryBytes)
+		err = d.dec.DecodeElement(target, &start)
+		d.input.ClearLimit()
+		if d.input.exceeded {
+			return true, fmt.Errorf("entry is larger than %d bytes (missing </entry>?), last complete entry was ent_seq %s",
+				*maxEntryBytes, d.lastSeqNo)
+		}
+		if err == nil {
+			if match := entSeqRx.FindStringSubmatch(d.Snippet()); match != nil {
+				d.lastSeqNo = match[1]
+			}
+		}
+		return true, err
+	}
+}
+
+//Snippet returns the start of the XML of the current entry, for use in error
+//messages.
+func (d *entryDecoder) Snippet() string {
+	return "<entry>" + d.input.Recorded()
+}
+
+//lineReader feeds the lines returned by nextLine into the xml.Decoder in
+//entryDecoder. The lines are joined without line breaks since nextLine()
+//has already removed the surrounding whitespace. Because lineReader implements
+//io.ByteReader, the decoder does not read ahead of the current token, so no
+//lines after </JMdict> are requested.
+type lineReader struct {
+	nextLine func() string
+	line     string
+	//the first bytes that were read since the last call to Mark()
+	recorded []byte
+	//the number of bytes that may be read after the call to Mark() (0 = no limit)
+	limit int
+	count int
+	//whether ReadByte() failed because of the limit
+	exceeded bool
+}
+
+//ReadByte implements the io.ByteReader interface.
+func (r *lineReader) ReadByte() (byte, error) {
+	if r.limit > 0 && r.count >= r.limit {
+		r.exceeded = true
+		return 0, fmt.Errorf("read more than %d bytes", r.limit)
+	}
+	r.count++
+	for r.line == "" {
+		r.line = r.nextLine()
+	}
+	b := r.line[0]
+	r.line = r.line[1:]
+	if len(r.recorded) < maxErrorSnippetBytes {
+		r.recorded = append(r.recorded, b)
+	}
+	return b, nil
+}
+
+//Read implements the io.Reader interface. It is not used by the xml.Decoder.
+func (r *lineReader) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	b, err := r.ReadByte()
+	buf[0] = b
+	return 1, err
+}
+
+//Mark starts recording the input for Recorded(). If limit is not 0, all reads
+//after the next limit bytes fail until ClearLimit() is called.
+func (r *lineReader) Mark(limit int) {
+	r.recorded = r.recorded[:0]
+	r.limit = limit
+	r.count = 0
+}
+
+//ClearLimit removes the limit that was set by Mark().
+func (r *lineReader) ClearLimit() {
+	r.limit = 0
+}
+
+//Recorded returns the start of the input since the last call to Mark(), for
+//use in error messages. Only the first maxErrorSnippetBytes are recorded, so
+//that entries are not held in memory in full.
+func (r *lineReader) Recorded() string {
+	return string(r.recorded)
+}
+
+//maxErrorSnippetBytes limits how much of a broken entry is shown by
+//describeEntryError().
+const maxErrorSnippetBytes = 300
+
+//describeEntryError adds context to an error returned by processEntry(), so that
+//a broken entry can be found in the input file. entryNo counts from 1. The
+//ent_seq is taken from the raw XML, since the entry could not be decoded.
+func describeEntryError(entryNo int, xmlStr string, err error) string {
+	seqNo := "unknown"
+	if match := entSeqRx.FindStringSubmatch(xmlStr); match != nil {
+		seqNo = match[1]
+	}
+	snippet := xmlStr
+	if len(snippet) > maxErrorSnippetBytes {
+		//do not cut in the middle of a UTF-8 sequence
+		cut := maxErrorSnippetBytes
+		for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+			cut--
+		}
+		snippet = snippet[:cut] + "..."
+	}
+	return fmt.Sprintf("entry #%d (ent_seq %s): %s\nin: %s", entryNo, seqNo, err.Error(), snippet)
+}
+
+//entryWriter writes the lines produced by processEntry() in the format selected
+//by -format. For "json-array", the entries are wrapped in [ and ] and separated
+//by commas, but each entry still goes on its own line, and nothing is buffered.
+//With Pretty, each entry is indented over multiple lines instead, and for
+//"ndjson", entries are separated by blank lines. For "tsv-glosses", entries are
+//not encoded into JSON at all and must be written with WriteGlossRows() instead.
+type entryWriter struct {
+	Writer   io.Writer
+	AsArray  bool
+	GlossTSV bool
+	Pretty   bool
+	count    int
+}
+
+func (w *entryWriter) Begin() error {
+	if w.GlossTSV {
+		_, err := io.WriteString(w.Writer, "form\tlanguage\tgloss\n")
+		return err
+	}
+	if !w.AsArray {
+		return nil
+	}
+	_, err := io.WriteString(w.Writer, "[\n")
+	return err
+}
+
+func (w *entryWriter) Write(jsonStr string) error {
+	if jsonStr == "" {
+		return nil //entry was dropped by a transform
+	}
+	if w.Pretty {
+		var buf bytes.Buffer
+		err := json.Indent(&buf, []byte(strings.TrimSuffix(jsonStr, "\n")), "", "\t")
+		if err != nil {
+			return err
+		}
+		jsonStr = buf.String() + "\n"
+		if w.count > 0 && !w.AsArray {
+			jsonStr = "\n" + jsonStr
+		}
+	}
+	if w.AsArray {
+		if w.count > 0 {
+			_, err := io.WriteString(w.Writer, ",\n")
+			if err != nil {
+				return err
+			}
+		}
+		jsonStr = strings.TrimSuffix(jsonStr, "\n")
+	}
+	w.count++
+	_, err := io.WriteString(w.Writer, jsonStr)
+	return err
+}
+
+//WriteGlossRows writes one row for each gloss of the entry, containing the
+//primary form of the entry (the first kanji element, or the first reading
+//element if there are no kanji elements), the gloss language and the gloss
+//text.
+func (w *entryWriter) WriteGlossRows(e dictEntry) error {
+	form := e.REle[0].Reb
+	if len(e.KEle) > 0 {
+		form = e.KEle[0].Keb
+	}
+	var buf strings.Builder
+	for _, sense := range e.Sense {
+		for _, gloss := range sense.Gloss {
+			lang := gloss.Lang
+			if lang == "" {
+				lang = "eng" //default value per DTD
+			}
+			fmt.Fprintf(&buf, "%s\t%s\t%s\n", escapeTSV(form), escapeTSV(lang), escapeTSV(gloss.Text))
+		}
+	}
+	w.count++
+	_, err := io.WriteString(w.Writer, buf.String())
+	return err
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+//escapeTSV escapes backslashes, tabs and line breaks in a TSV field.
+func escapeTSV(field string) string {
+	return tsvEscaper.Replace(field)
+}
+
+func (w *entryWriter) Finish() error {
+	if !w.AsArray {
+		return nil
+	}
+	closing := "]\n"
+	if w.count > 0 {
+		closing = "\n]\n"
+	}
+	_, err := io.WriteString(w.Writer, closing)
+	return err
+}
+
+//shardWriter writes entries into a sequence of files that each stay below
+//MaxBytes, and lists them in entrypack.shards.json. The jmdict-traverse crate
+//reads the shards in the order given there.
+type shardWriter struct {
+	Dir      string
+	MaxBytes int
+	shards   []shardInfo
+	file     *os.File
+}
+
+type shardInfo struct {
+	Path     string `json:"path"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Bytes    int    `json:"bytes"`
+	//the number of entries in this shard (not counting the header)
+	Entries int `json:"entries"`
+}
+
+func (w *shardWriter) Write(seqNo uint64, jsonStr string) error {
+	if jsonStr == "" {
+		return nil //entry was dropped by a transform
+	}
+	if len(jsonStr) > w.MaxBytes {
+		return fmt.Errorf("entry %d alone is larger than %d bytes", seqNo, w.MaxBytes)
+	}
+
+	//start a new shard if necessary
+	if w.file == nil || w.shards[len(w.shards)-1].Bytes+len(jsonStr) > w.MaxBytes {
+		if w.file != nil {
+			err := w.file.Close()
+			if err != nil {
+				return err
+			}
 		}
+		name := fmt.Sprintf("entrypack.%03d.json", len(w.shards))
+		file, err := os.Create(stagedPath(filepath.Join(w.Dir, name)))
+		if err != nil {
+			return err
+		}
+		w.file = file
+		w.shards = append(w.shards, shardInfo{Path: name, FirstSeq: seqNo})
+	}
+
+	_, err := io.WriteString(w.file, jsonStr)
+	if err != nil {
+		return err
+	}
+	shard := &w.shards[len(w.shards)-1]
+	if shard.FirstSeq == 0 {
+		shard.FirstSeq = seqNo //first shard starts with the header
+	}
+	shard.LastSeq = seqNo
+	shard.Bytes += len(jsonStr)
+	shard.Entries++
+	return nil
+}
+
+//WriteHeader puts the packHeader at the start of the first shard. This must be
+//called before Write().
+func (w *shardWriter) WriteHeader(jsonStr string) error {
+	err := w.Write(0, jsonStr)
+	if err == nil {
+		w.shards[0].LastSeq = 0
+		w.shards[0].Entries = 0
 	}
+	return err
+}
+
+func (w *shardWriter) Finish() error {
+	if w.file != nil {
+		err := w.file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	shards := w.shards
+	if shards == nil {
+		shards = []shardInfo{} //serialize as [] instead of null
+	}
+	buf, err := json.MarshalIndent(map[string]interface{}{"shards": shards}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stagedPath(filepath.Join(w.Dir, "entrypack.shards.json")), append(buf, '\n'), 0666)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -137,66 +1038,1515 @@ func processEntries(nextLine func() string) {
 // limit of 100 MiB per object.
 
 type dictEntry struct {
-	SeqNo uint64      `xml:"ent_seq" json:"n"`
-	KEle  []dictKEle  `xml:"k_ele" json:"K,omitempty"`
-	REle  []dictREle  `xml:"r_ele" json:"R"`
-	Sense []dictSense `xml:"sense" json:"S"`
+	SeqNo uint64      `xml:"ent_seq" json:"n" desc:"sequence number of this entry (<ent_seq>)" verbose:"sequence"`
+	KEle  []dictKEle  `xml:"k_ele" json:"K,omitempty" desc:"kanji elements (<k_ele>)" verbose:"kanji"`
+	REle  []dictREle  `xml:"r_ele" json:"R" desc:"reading elements (<r_ele>), at least one" verbose:"readings"`
+	Sense []dictSense `xml:"sense" json:"S" desc:"senses (<sense>)" verbose:"senses"`
 }
 
 type dictKEle struct {
-	Keb   string   `xml:"keb" json:"t"`
-	KeInf []string `xml:"ke_inf" json:"i,omitempty"`
-	KePri []string `xml:"ke_pri" json:"p,omitempty"`
+	Keb   string   `xml:"keb" json:"t" desc:"text of this kanji element (<keb>)" verbose:"text"`
+	KeInf []string `xml:"ke_inf" json:"i,omitempty" desc:"info codes like \"ateji\" (<ke_inf>)" verbose:"info"`
+	KePri []string `xml:"ke_pri" json:"p,omitempty" desc:"priority codes like \"news1\" (<ke_pri>)" verbose:"priority"`
 }
 
 type dictREle struct {
-	Reb       string         `xml:"reb" json:"t"`
-	ReNokanji boolByPresence `xml:"re_nokanji" json:"n,omitempty"`
-	ReRestr   []string       `xml:"re_restr" json:"r,omitempty"`
-	ReInf     []string       `xml:"re_inf" json:"i,omitempty"`
-	RePri     []string       `xml:"re_pri" json:"p,omitempty"`
+	Reb       string         `xml:"reb" json:"t" desc:"text of this reading element (<reb>)" verbose:"text"`
+	ReNokanji boolByPresence `xml:"re_nokanji" json:"n,omitempty" desc:"whether this reading is not a true reading of the kanji elements (<re_nokanji>)" verbose:"no_kanji"`
+	ReRestr   []string       `xml:"re_restr" json:"r,omitempty" desc:"if not empty, this reading only applies to the kanji elements with these texts (<re_restr>)" verbose:"restricted_to"`
+	ReInf     []string       `xml:"re_inf" json:"i,omitempty" desc:"info codes like \"ok\" (<re_inf>)" verbose:"info"`
+	RePri     []string       `xml:"re_pri" json:"p,omitempty" desc:"priority codes like \"news1\" (<re_pri>)" verbose:"priority"`
 }
 
 type dictSense struct {
-	Stagk   []string      `xml:"stagk" json:"stagk,omitempty"`
-	Stagr   []string      `xml:"stagr" json:"stagr,omitempty"`
-	Pos     []string      `xml:"pos" json:"p,omitempty"`
-	Xref    []string      `xml:"xref" json:"xref,omitempty"`
-	Ant     []string      `xml:"ant" json:"ant,omitempty"`
-	Field   []string      `xml:"field" json:"f,omitempty"`
-	Misc    []string      `xml:"misc" json:"m,omitempty"`
-	SInf    []string      `xml:"s_inf" json:"i,omitempty"`
-	Lsource []dictLsource `xml:"lsource" json:"L,omitempty"`
-	Dial    []string      `xml:"dial" json:"dial,omitempty"`
-	Gloss   []dictGloss   `xml:"gloss" json:"G,omitempty"`
+	Stagk   []string      `xml:"stagk" json:"stagk,omitempty" desc:"if not empty, this sense only applies to the kanji elements with these texts (<stagk>)" verbose:"restricted_to_kanji"`
+	Stagr   []string      `xml:"stagr" json:"stagr,omitempty" desc:"if not empty, this sense only applies to the reading elements with these texts (<stagr>)" verbose:"restricted_to_readings"`
+	Pos     []string      `xml:"pos" json:"p,omitempty" desc:"part-of-speech codes like \"n\" (<pos>)" verbose:"parts_of_speech"`
+	Xref    []string      `xml:"xref" json:"xref,omitempty" desc:"cross-references to related entries (<xref>)" verbose:"cross_references"`
+	Ant     []string      `xml:"ant" json:"ant,omitempty" desc:"references to antonyms (<ant>)" verbose:"antonyms"`
+	Field   []string      `xml:"field" json:"f,omitempty" desc:"field-of-application codes like \"comp\" (<field>)" verbose:"fields"`
+	Misc    []string      `xml:"misc" json:"m,omitempty" desc:"miscellaneous info codes like \"arch\" (<misc>)" verbose:"misc"`
+	SInf    []string      `xml:"s_inf" json:"i,omitempty" desc:"freetext information about this sense (<s_inf>)" verbose:"info"`
+	Lsource []dictLsource `xml:"lsource" json:"L,omitempty" desc:"source words of loanwords (<lsource>)" verbose:"loanword_sources"`
+	Dial    []string      `xml:"dial" json:"dial,omitempty" desc:"dialect codes like \"ksb\" (<dial>)" verbose:"dialects"`
+	Gloss   []dictGloss   `xml:"gloss" json:"G,omitempty" desc:"translations (<gloss>)" verbose:"glosses"`
 }
 
 type dictLsource struct {
-	Text    string `xml:",chardata" json:"t"`
-	Lang    string `xml:"lang,attr" json:"l,omitempty"`
-	LsType  string `xml:"ls_type,attr" json:"type,omitempty"`
-	LsWasei string `xml:"ls_wasei,attr" json:"wasei,omitempty"`
+	Text    string `xml:",chardata" json:"t" desc:"the source word, may be empty" verbose:"text"`
+	Lang    string `xml:"lang,attr" json:"l,omitempty" desc:"ISO 639-2/B code of the source language, \"eng\" if omitted" verbose:"language"`
+	LsType  string `xml:"ls_type,attr" json:"type,omitempty" desc:"\"part\" if the source word only applies to part of the loanword" verbose:"type"`
+	LsWasei string `xml:"ls_wasei,attr" json:"wasei,omitempty" desc:"\"y\" if the loanword is wasei-eigo" verbose:"wasei"`
 }
 
 type dictGloss struct {
-	Text  string   `xml:",chardata" json:"t"`
-	Lang  string   `xml:"lang,attr" json:"l,omitempty"`
-	GGend string   `xml:"g_gend,attr" json:"g_gend,omitempty"`
-	GType string   `xml:"g_type,attr" json:"g_type,omitempty"`
-	Pri   []string `xml:"pri" json:"pri,omitempty"`
+	Text  string   `xml:",chardata" json:"t" desc:"text of this gloss" verbose:"text"`
+	Lang  string   `xml:"lang,attr" json:"l,omitempty" desc:"ISO 639-2/B code of the language of this gloss, \"eng\" if omitted" verbose:"language"`
+	GGend string   `xml:"g_gend,attr" json:"g_gend,omitempty" desc:"gender of the gloss (unused)" verbose:"gender"`
+	GType string   `xml:"g_type,attr" json:"g_type,omitempty" desc:"gloss type like \"lit\" or \"expl\"" verbose:"type"`
+	Pri   []string `xml:"pri" json:"pri,omitempty" desc:"priority markers (unused)" verbose:"priority"`
 	//NOTE: g_gend and <pri> are defined in the DTD, but do not actually occur in any entry.
 }
 
 var decoderEntities = make(map[string]string)
 
-func processEntry(xmlStr string) string {
-	var e dictEntry
+//processEntry converts a single <entry> from XML into a line of JSON. Errors are
+//returned instead of panicking, so that this can be fuzzed (see
+//FuzzProcessEntry). If the entry is dropped by a transform, an empty string is
+//returned. processEntries() runs the same steps, but decodes all entries from a
+//single stream instead.
+func processEntry(xmlStr string) (string, error) {
+	e, err := decodeEntry(xmlStr)
+	if err != nil {
+		return "", err
+	}
+	if !prepareEntry(&e) {
+		return "", nil
+	}
+	return encodeEntry(e)
+}
+
+//decodeEntry is the first step of processEntry().
+func decodeEntry(xmlStr string) (dictEntry, error) {
+	var e dictEntry
 	dec := xml.NewDecoder(strings.NewReader(xmlStr))
 	dec.Entity = decoderEntities
-	must(dec.Decode(&e))
+	err := dec.Decode(&e)
+	if err != nil {
+		return e, err
+	}
+	return e, validateEntry(e)
+}
+
+//validateEntry checks requirements of the DTD that the XML decoder does not
+//enforce.
+func validateEntry(e dictEntry) error {
+	if len(e.REle) == 0 {
+		//the DTD requires at least one <r_ele>, and the Rust side relies on this
+		return fmt.Errorf("entry %d does not have any <r_ele>", e.SeqNo)
+	}
+	return nil
+}
+
+//prepareEntry is the second step of processEntry(). It applies all filters and
+//transforms, and returns false if the entry shall be dropped.
+func prepareEntry(e *dictEntry) bool {
+	if allowedSeqNos != nil {
+		if _, allowed := allowedSeqNos[e.SeqNo]; !allowed {
+			return false
+		}
+		allowedSeqNos[e.SeqNo] = true
+	}
+	if !isInSeqNoRange(e.SeqNo, *seqMin, *seqMax) {
+		return false
+	}
+	if selectedPartsOfSpeech != nil && !hasAnyPartOfSpeech(*e, selectedPartsOfSpeech) {
+		return false
+	}
+	for _, supplement := range glossSupplements {
+		if !supplement.mergeInto(e) {
+			fmt.Fprintf(os.Stderr, "entry %d: not merging glosses from -merge-glosses because the entry already has glosses in %q\n",
+				e.SeqNo, supplement.Lang)
+		}
+	}
+	//this needs to look at the entry before transforms like -transform=english-only remove glosses
+	collectUnknownGlossLanguages(*e)
+	collectUnknownEntities(*e)
+	if selectedGlossLanguages != nil {
+		filterGlossLanguages(e, selectedGlossLanguages)
+	}
+	for _, transform := range selectedTransforms {
+		if !transform(e) {
+			return false
+		}
+	}
+	if *minPriority > 0 && !hasPriorityAtLeast(*e, *minPriority) {
+		droppedByMinPriority++
+		return false
+	}
+	if *reportDuplicateGlosses {
+		reportDuplicateGlossesIn(*e)
+	}
+	return true
+}
+
+//encodeEntry is the last step of processEntry().
+func encodeEntry(e dictEntry) (string, error) {
 	jsonBytes, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if *selfCheck {
+		err := checkRoundTrip(e, jsonBytes)
+		if err != nil {
+			return "", err
+		}
+	}
+	if *prettyDebug {
+		e = expandEntities(e)
+	}
+	if *verboseKeys {
+		jsonBytes, err = marshalVerbose(reflect.ValueOf(e))
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(jsonBytes) + "\n", nil
+}
+
+//expandEntities replaces the entity names in the entry with their definitions
+//from entitySets, e.g. "arch" becomes "archaic". Values without a definition are
+//kept as they are. This is only used for -pretty-debug, since the jmdict crate
+//expects the entity names.
+func expandEntities(e dictEntry) dictEntry {
+	expand := func(set string, values []string) []string {
+		var result []string
+		for _, value := range values {
+			if definition, exists := entitySets[set][value]; exists {
+				value = definition
+			}
+			result = append(result, value)
+		}
+		return result
+	}
+	//copy all slices that are modified, so that the original entry stays intact
+	e.KEle = append([]dictKEle(nil), e.KEle...)
+	for idx := range e.KEle {
+		e.KEle[idx].KeInf = expand("ke_inf", e.KEle[idx].KeInf)
+	}
+	e.REle = append([]dictREle(nil), e.REle...)
+	for idx := range e.REle {
+		e.REle[idx].ReInf = expand("re_inf", e.REle[idx].ReInf)
+	}
+	e.Sense = append([]dictSense{}, e.Sense...) //not nil, so that it is not serialized as null
+	for idx := range e.Sense {
+		sense := &e.Sense[idx]
+		sense.Pos = expand("pos", sense.Pos)
+		sense.Field = expand("field", sense.Field)
+		sense.Misc = expand("misc", sense.Misc)
+		sense.Dial = expand("dial", sense.Dial)
+	}
+	return e
+}
+
+//marshalVerbose works like json.Marshal, but uses the keys from the "verbose"
+//struct tags. We cannot just have a second set of types with different "json"
+//struct tags since the types are nested.
+func marshalVerbose(v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for idx := 0; idx < v.Len(); idx++ {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			elemBytes, err := marshalVerbose(v.Index(idx))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(elemBytes)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	case reflect.Struct:
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for idx := 0; idx < v.NumField(); idx++ {
+			key, omitEmpty := fieldKey(v.Type().Field(idx))
+			value := v.Field(idx)
+			if omitEmpty && isEmptyValue(value) {
+				continue
+			}
+			valueBytes, err := marshalVerbose(value)
+			if err != nil {
+				return nil, err
+			}
+			if buf.Len() > 1 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "%q:", key)
+			buf.Write(valueBytes)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	default:
+		return json.Marshal(v.Interface())
+	}
+}
+
+//fieldKey returns the JSON key for the given struct field, and whether the
+//field is omitted when empty. With -verbose-keys, the key is taken from the
+//"verbose" struct tag instead of the "json" struct tag.
+func fieldKey(field reflect.StructField) (key string, omitEmpty bool) {
+	jsonTag := strings.Split(field.Tag.Get("json"), ",")
+	key = jsonTag[0]
+	if *verboseKeys {
+		key = field.Tag.Get("verbose")
+	}
+	return key, containsString(jsonTag[1:], "omitempty")
+}
+
+//isEmptyValue follows the definition of "empty" for the "omitempty" option of
+//encoding/json, restricted to the kinds that occur in dictEntry.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+//checkRoundTrip returns an error if the given JSON does not decode into the
+//given entry. This catches struct tag mistakes that would otherwise only
+//surface when building the crate, or not at all if a field is silently dropped.
+func checkRoundTrip(e dictEntry, jsonBytes []byte) error {
+	var decoded dictEntry
+	err := json.Unmarshal(jsonBytes, &decoded)
+	if err != nil {
+		return fmt.Errorf("entry %d: cannot decode generated JSON: %s", e.SeqNo, err.Error())
+	}
+	if !reflect.DeepEqual(e, decoded) {
+		return fmt.Errorf("entry %d: generated JSON does not round-trip: expected %#v, got %#v from %s",
+			e.SeqNo, e, decoded, string(jsonBytes))
+	}
+	return nil
+}
+
+//reportDuplicateGlossesIn prints a line on stderr for each gloss text that
+//appears in more than one language within the same entry. This often
+//indicates glosses that were copied over from English without translation.
+func reportDuplicateGlossesIn(e dictEntry) {
+	var (
+		texts     []string
+		languages = make(map[string][]string)
+	)
+	for _, sense := range e.Sense {
+		for _, gloss := range sense.Gloss {
+			lang := gloss.Lang
+			if lang == "" {
+				lang = "eng" //default value per DTD
+			}
+			langs, exists := languages[gloss.Text]
+			if !exists {
+				texts = append(texts, gloss.Text)
+			}
+			if !containsString(langs, lang) {
+				languages[gloss.Text] = append(langs, lang)
+			}
+		}
+	}
+
+	for _, text := range texts {
+		langs := languages[text]
+		if len(langs) > 1 {
+			fmt.Fprintf(os.Stderr, "entry %d: gloss %q appears in multiple languages: %s\n",
+				e.SeqNo, text, strings.Join(langs, ", "))
+		}
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, elem := range list {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
+
+//allowedSeqNos contains the sequence numbers listed in the -only-seqs file, or
+//is nil if -only-seqs was not given. The value is set to true once an entry
+//with this sequence number was found.
+var allowedSeqNos map[uint64]bool
+
+//readSeqNoAllowList parses the file given with -only-seqs. It contains one
+//sequence number per line. Empty lines and comments starting with "#" are
+//ignored.
+func readSeqNoAllowList(r io.Reader) (map[uint64]bool, error) {
+	result := make(map[uint64]bool)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		seqNo, err := strconv.ParseUint(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid sequence number %q", lineNo, line)
+		}
+		result[seqNo] = false
+	}
+	return result, scanner.Err()
+}
+
+//reportMissingAllowedSeqNos prints the sequence numbers from the -only-seqs
+//file that did not appear in the input, e.g. because the entry was removed
+//from the JMdict.
+func reportMissingAllowedSeqNos(w io.Writer) {
+	var missingSeqNos []uint64
+	for seqNo, found := range allowedSeqNos {
+		if !found {
+			missingSeqNos = append(missingSeqNos, seqNo)
+		}
+	}
+	sort.Slice(missingSeqNos, func(i, j int) bool { return missingSeqNos[i] < missingSeqNos[j] })
+	missing := make([]string, len(missingSeqNos))
+	for idx, seqNo := range missingSeqNos {
+		missing[idx] = strconv.FormatUint(seqNo, 10)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(w, "%d sequence numbers from -only-seqs were not found: %s\n",
+			len(missing), strings.Join(missing, ", "))
+	}
+}
+
+//glossSupplement contains glosses in one language from a file given with
+//-merge-glosses. The file contains a JSON object whose keys are sequence numbers
+//and whose values are lists of senses, each being a list of gloss texts:
+//
+//	{"1000100": [["first gloss of sense 1", "second gloss of sense 1"], ["sense 2"]]}
+type glossSupplement struct {
+	Lang   string
+	Senses map[uint64][][]string
+	//the sequence numbers for which Senses were merged (or refused to merge)
+	seen map[uint64]bool
+}
+
+var glossSupplements []*glossSupplement
+
+//parseMergeGlossesSpec parses one LANG:FILE pair from -merge-glosses.
+func parseMergeGlossesSpec(spec string) (lang, path string, err error) {
+	fields := strings.SplitN(spec, ":", 2)
+	if len(fields) != 2 || len(fields[0]) != 3 || fields[1] == "" {
+		return "", "", fmt.Errorf("invalid value for -merge-glosses: %q (expected LANG:FILE, e.g. ger:glosses.json)", spec)
+	}
+	return fields[0], fields[1], nil
+}
+
+func readGlossSupplement(lang string, r io.Reader) (*glossSupplement, error) {
+	var data map[string][][]string
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	result := &glossSupplement{
+		Lang:   lang,
+		Senses: make(map[uint64][][]string, len(data)),
+		seen:   make(map[uint64]bool),
+	}
+	for key, senses := range data {
+		seqNo, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence number %q", key)
+		}
+		result.Senses[seqNo] = senses
+	}
+	return result, nil
+}
+
+//mergeInto appends the supplementary senses for this entry (if any) to the
+//entry. If the entry already has glosses in the supplement's language, it is
+//not changed and false is returned.
+func (s *glossSupplement) mergeInto(e *dictEntry) bool {
+	senses, exists := s.Senses[e.SeqNo]
+	if !exists {
+		return true
+	}
+	s.seen[e.SeqNo] = true
+	for _, sense := range e.Sense {
+		for _, gloss := range sense.Gloss {
+			if gloss.Lang == s.Lang || (gloss.Lang == "" && s.Lang == "eng") {
+				return false
+			}
+		}
+	}
+	for _, texts := range senses {
+		if len(texts) == 0 {
+			continue
+		}
+		lang := s.Lang
+		if lang == "eng" {
+			lang = "" //like in the JMdict, where "eng" is the default value
+		}
+		var sense dictSense
+		for _, text := range texts {
+			sense.Gloss = append(sense.Gloss, dictGloss{Text: text, Lang: lang})
+		}
+		e.Sense = append(e.Sense, sense)
+	}
+	return true
+}
+
+//reportUnused prints how many entries from the supplement did not occur in the
+//input, e.g. because they were removed from the JMdict.
+func (s *glossSupplement) reportUnused(w io.Writer) {
+	unused := len(s.Senses) - len(s.seen)
+	if unused > 0 {
+		fmt.Fprintf(w, "-merge-glosses: %d entries with glosses in %q were not found in the input\n", unused, s.Lang)
+	}
+}
+
+//knownGlossLanguages are the gloss languages that the jmdict crate knows about.
+//They are read from the same file that jmdict-enums/build.rs generates the
+//GlossLanguage enum from.
+var knownGlossLanguages map[string]bool
+
+//readKnownGlossLanguages reads the language codes from a languages.json file.
+func readKnownGlossLanguages(path string) map[string]bool {
+	buf, err := ioutil.ReadFile(path)
 	must(err)
-	return string(jsonBytes) + "\n"
+	var languages []struct {
+		Code string `json:"code"`
+	}
+	must(json.Unmarshal(buf, &languages))
+	result := make(map[string]bool, len(languages))
+	for _, l := range languages {
+		result[l.Code] = true
+	}
+	return result
+}
+
+//selectedGlossLanguages contains the languages given with -langs, or is nil if
+//all languages shall be kept.
+var selectedGlossLanguages map[string]bool
+
+//parseGlossLanguages parses the value of -langs. Language codes are
+//case-insensitive, and must be in knownGlossLanguages.
+func parseGlossLanguages(spec string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, lang := range strings.Split(spec, ",") {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if !knownGlossLanguages[lang] {
+			return nil, fmt.Errorf("unknown language %q in -langs (known languages: %s)",
+				lang, strings.Join(sortedKeys(knownGlossLanguages), ", "))
+		}
+		result[lang] = true
+	}
+	return result, nil
+}
+
+//filterGlossLanguages removes all glosses in languages other than the given
+//ones, and removes senses that have no glosses left. Unlike
+//-transform=english-only, the entry is kept even if it has no senses left, so
+//that it can still be found by its sequence number.
+func filterGlossLanguages(e *dictEntry, langs map[string]bool) {
+	senses := []dictSense{} //serialize as [] instead of null if all senses are dropped
+	for _, sense := range e.Sense {
+		var glosses []dictGloss
+		for _, gloss := range sense.Gloss {
+			lang := gloss.Lang
+			if lang == "" {
+				lang = "eng" //default value per DTD
+			}
+			if langs[lang] {
+				glosses = append(glosses, gloss)
+			}
+		}
+		if len(glosses) > 0 {
+			sense.Gloss = glosses
+			senses = append(senses, sense)
+		}
+	}
+	e.Sense = senses
+}
+
+//unknownLanguageStats describes the occurrences of a gloss language that is not
+//in knownGlossLanguages.
+type unknownLanguageStats struct {
+	GlossCount int
+	//the first few entries with glosses in this language
+	SampleSeqNos []uint64
+}
+
+//maxSampleSeqNos is how many sequence numbers are remembered per unknown
+//gloss language.
+const maxSampleSeqNos = 5
+
+//unknownGlossLanguages is filled by collectUnknownGlossLanguages.
+var unknownGlossLanguages = make(map[string]*unknownLanguageStats)
+
+//collectUnknownGlossLanguages records all glosses in the entry whose language
+//is not in knownGlossLanguages. Unknown or malformed language codes usually
+//indicate a new language in the JMdict, or a corrupted or wrong input file.
+func collectUnknownGlossLanguages(e dictEntry) {
+	for _, sense := range e.Sense {
+		for _, gloss := range sense.Gloss {
+			//an empty lang means "eng" per DTD
+			if gloss.Lang == "" || knownGlossLanguages[gloss.Lang] {
+				continue
+			}
+			stats := unknownGlossLanguages[gloss.Lang]
+			if stats == nil {
+				stats = &unknownLanguageStats{}
+				unknownGlossLanguages[gloss.Lang] = stats
+			}
+			stats.GlossCount++
+			n := len(stats.SampleSeqNos)
+			if n < maxSampleSeqNos && (n == 0 || stats.SampleSeqNos[n-1] != e.SeqNo) {
+				stats.SampleSeqNos = append(stats.SampleSeqNos, e.SeqNo)
+			}
+		}
+	}
+}
+
+//reportUnknownGlossLanguages prints one line for each language found by
+//collectUnknownGlossLanguages, in alphabetical order.
+func reportUnknownGlossLanguages(w io.Writer) {
+	langs := make([]string, 0, len(unknownGlossLanguages))
+	for lang := range unknownGlossLanguages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		stats := unknownGlossLanguages[lang]
+		samples := make([]string, len(stats.SampleSeqNos))
+		for idx, seqNo := range stats.SampleSeqNos {
+			samples[idx] = strconv.FormatUint(seqNo, 10)
+		}
+		fmt.Fprintf(w, "found %d glosses in unknown language %q, e.g. in entries %s\n",
+			stats.GlossCount, lang, strings.Join(samples, ", "))
+	}
+}
+
+//entitySets contains the entity definitions that were read by processOpening()
+//or loadDecoderEntities(), indexed by the name of the element that uses them.
+//This is nil until either of those functions has run.
+var entitySets map[string]map[string]string
+
+//unknownEntityKey identifies a value in an entry that does not have a
+//definition in the entity set for its element.
+type unknownEntityKey struct {
+	Set   string //e.g. "pos"
+	Value string
+}
+
+//unknownEntityStats describes the occurrences of an unknownEntityKey.
+type unknownEntityStats struct {
+	Count int
+	//the first few entries with this value
+	SampleSeqNos []uint64
+}
+
+//unknownEntities is filled by collectUnknownEntities.
+var unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+
+//collectUnknownEntities records all values in the entry whose element uses
+//entities, but which are not defined in the respective entity set. The XML
+//decoder already rejects undefined entities, so this catches values that were
+//written as plain text or that use an entity from a different set. The Rust
+//side looks up all of these values in entities.json when generating enums, so
+//they would otherwise only fail there.
+func collectUnknownEntities(e dictEntry) {
+	for _, k := range e.KEle {
+		collectUnknownEntityValues("ke_inf", k.KeInf, e.SeqNo)
+	}
+	for _, r := range e.REle {
+		collectUnknownEntityValues("re_inf", r.ReInf, e.SeqNo)
+	}
+	for _, sense := range e.Sense {
+		collectUnknownEntityValues("pos", sense.Pos, e.SeqNo)
+		collectUnknownEntityValues("field", sense.Field, e.SeqNo)
+		collectUnknownEntityValues("misc", sense.Misc, e.SeqNo)
+		collectUnknownEntityValues("dial", sense.Dial, e.SeqNo)
+	}
+}
+
+//collectUnknownEntityValues is the part of collectUnknownEntities() that is
+//shared with collectUnknownNameEntities().
+func collectUnknownEntityValues(set string, values []string, seqNo uint64) {
+	if entitySets == nil {
+		return
+	}
+	for _, value := range values {
+		if _, exists := entitySets[set][value]; exists {
+			continue
+		}
+		key := unknownEntityKey{set, value}
+		stats := unknownEntities[key]
+		if stats == nil {
+			stats = &unknownEntityStats{}
+			unknownEntities[key] = stats
+		}
+		stats.Count++
+		n := len(stats.SampleSeqNos)
+		if n < maxSampleSeqNos && (n == 0 || stats.SampleSeqNos[n-1] != seqNo) {
+			stats.SampleSeqNos = append(stats.SampleSeqNos, seqNo)
+		}
+	}
+}
+
+//reportUnknownEntities prints one line for each value found by
+//collectUnknownEntities, ordered by element and value.
+func reportUnknownEntities(w io.Writer) {
+	keys := make([]unknownEntityKey, 0, len(unknownEntities))
+	for key := range unknownEntities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Set != keys[j].Set {
+			return keys[i].Set < keys[j].Set
+		}
+		return keys[i].Value < keys[j].Value
+	})
+	for _, key := range keys {
+		stats := unknownEntities[key]
+		samples := make([]string, len(stats.SampleSeqNos))
+		for idx, seqNo := range stats.SampleSeqNos {
+			samples[idx] = strconv.FormatUint(seqNo, 10)
+		}
+		fmt.Fprintf(w, "found %d uses of <%s>%s</%s> without entity definition, e.g. in entries %s\n",
+			stats.Count, key.Set, key.Value, key.Set, strings.Join(samples, ", "))
+	}
+}
+
+//droppedByMinPriority counts the entries dropped because of -min-priority.
+var droppedByMinPriority int
+
+//qualifyingPriorities are the priority markers that satisfy -min-priority
+//regardless of the chosen frequency bucket.
+var qualifyingPriorities = map[string]bool{"news1": true, "ichi1": true, "spec1": true, "gai1": true}
+
+//hasPriorityAtLeast checks whether any kanji or reading element of the entry
+//has one of the qualifyingPriorities, or is in the frequency bucket nfXX with
+//XX <= maxBucket.
+func hasPriorityAtLeast(e dictEntry, maxBucket int) bool {
+	var markers []string
+	for _, k := range e.KEle {
+		markers = append(markers, k.KePri...)
+	}
+	for _, r := range e.REle {
+		markers = append(markers, r.RePri...)
+	}
+	for _, marker := range markers {
+		if qualifyingPriorities[marker] {
+			return true
+		}
+		if strings.HasPrefix(marker, "nf") {
+			bucket, err := strconv.Atoi(strings.TrimPrefix(marker, "nf"))
+			if err == nil && bucket <= maxBucket {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//isInSeqNoRange implements -seq-min and -seq-max. A limit of 0 means that
+//there is no limit on that side.
+func isInSeqNoRange(seqNo, min, max uint64) bool {
+	return seqNo >= min && (max == 0 || seqNo <= max)
+}
+
+//selectedPartsOfSpeech contains the codes from -pos, or nil if not given.
+var selectedPartsOfSpeech map[string]bool
+
+//parsePartsOfSpeech parses the value of -pos.
+func parsePartsOfSpeech(spec string) map[string]bool {
+	result := make(map[string]bool)
+	for _, pos := range strings.Split(spec, ",") {
+		result[strings.TrimSpace(pos)] = true
+	}
+	return result
+}
+
+//checkPartsOfSpeech reports codes from -pos that are not defined in the DTD,
+//since a typo would otherwise silently drop all entries.
+func checkPartsOfSpeech(codes map[string]bool) error {
+	for _, pos := range sortedKeys(codes) {
+		if _, exists := entitySets["pos"][pos]; !exists {
+			return fmt.Errorf("unknown part of speech %q in -pos (known codes: %s)",
+				pos, strings.Join(sortedKeys(entitySets["pos"]), ", "))
+		}
+	}
+	return nil
+}
+
+//hasAnyPartOfSpeech checks whether any sense of the entry has one of the given
+//part-of-speech codes. Senses without <pos> inherit the parts of speech from
+//the previous sense, but those are always present on an earlier sense of the
+//same entry, so only the explicit codes need to be checked.
+func hasAnyPartOfSpeech(e dictEntry, codes map[string]bool) bool {
+	for _, sense := range e.Sense {
+		for _, pos := range sense.Pos {
+			if codes[pos] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// transforms for individual entries (selected with -transform)
+
+//entryTransforms contains all transforms that can be selected with -transform.
+//Each transform modifies the entry in place, and returns false if the entry
+//shall be dropped entirely. To add a transform, add it to this list and
+//document it in README.md.
+var entryTransforms = map[string]func(e *dictEntry) bool{
+	"common-only":  transformCommonOnly,
+	"drop-xrefs":   transformDropXrefs,
+	"english-only": transformEnglishOnly,
+}
+
+var selectedTransforms []func(e *dictEntry) bool
+
+func selectTransforms(names string) {
+	if names == "" {
+		return
+	}
+	for _, name := range strings.Split(names, ",") {
+		transform, exists := entryTransforms[name]
+		if !exists {
+			var available []string
+			for name := range entryTransforms {
+				available = append(available, name)
+			}
+			sort.Strings(available)
+			panic(fmt.Sprintf("unknown transform %q (available: %s)", name, strings.Join(available, ", ")))
+		}
+		selectedTransforms = append(selectedTransforms, transform)
+	}
+}
+
+//transformCommonOnly removes all kanji and reading elements without priority
+//markers, just like the Rust side does unless the "scope-uncommon" feature is
+//selected. Entries without common readings are dropped.
+func transformCommonOnly(e *dictEntry) bool {
+	var (
+		kEle []dictKEle
+		rEle []dictREle
+	)
+	for _, k := range e.KEle {
+		if len(k.KePri) > 0 {
+			kEle = append(kEle, k)
+		}
+	}
+	for _, r := range e.REle {
+		if len(r.RePri) > 0 {
+			rEle = append(rEle, r)
+		}
+	}
+	e.KEle, e.REle = kEle, rEle
+	return len(e.REle) > 0
+}
+
+//transformDropXrefs removes all cross-references and antonyms, for consumers
+//that do not resolve them anyway.
+func transformDropXrefs(e *dictEntry) bool {
+	for idx := range e.Sense {
+		e.Sense[idx].Xref = nil
+		e.Sense[idx].Ant = nil
+	}
+	return true
+}
+
+//transformEnglishOnly removes all glosses in languages other than English.
+//Senses without English glosses, and entries without such senses, are dropped.
+func transformEnglishOnly(e *dictEntry) bool {
+	var senses []dictSense
+	for _, sense := range e.Sense {
+		var glosses []dictGloss
+		for _, gloss := range sense.Gloss {
+			if gloss.Lang == "" || gloss.Lang == "eng" {
+				glosses = append(glosses, gloss)
+			}
+		}
+		if len(glosses) > 0 {
+			sense.Gloss = glosses
+			senses = append(senses, sense)
+		}
+	}
+	e.Sense = senses
+	return len(e.Sense) > 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// compare two versions of entrypack.json
+
+type entryDiff struct {
+	SeqNo    uint64   `json:"seq"`
+	Headword string   `json:"headword"`
+	Changes  []string `json:"changes,omitempty"`
+}
+
+type diffReport struct {
+	Added    []entryDiff `json:"added"`
+	Removed  []entryDiff `json:"removed"`
+	Modified []entryDiff `json:"modified"`
+}
+
+func diffEntrypacks(oldPath, newPath string) {
+	oldEntries := readEntrypack(oldPath)
+	newEntries := readEntrypack(newPath)
+
+	report := diffReport{
+		Added:    []entryDiff{},
+		Removed:  []entryDiff{},
+		Modified: []entryDiff{},
+	}
+	for _, seqNo := range sortedSeqNos(oldEntries, newEntries) {
+		oldEntry, inOld := oldEntries[seqNo]
+		newEntry, inNew := newEntries[seqNo]
+		switch {
+		case !inOld:
+			report.Added = append(report.Added, entryDiff{seqNo, headwordOf(newEntry), nil})
+		case !inNew:
+			report.Removed = append(report.Removed, entryDiff{seqNo, headwordOf(oldEntry), nil})
+		case !reflect.DeepEqual(oldEntry, newEntry):
+			report.Modified = append(report.Modified, entryDiff{seqNo, headwordOf(newEntry), describeChanges(oldEntry, newEntry)})
+		}
+	}
+
+	if *diffAsJSON {
+		buf, err := json.MarshalIndent(report, "", "\t")
+		must(err)
+		fmt.Println(string(buf))
+		return
+	}
+	for _, d := range report.Added {
+		fmt.Printf("+ %d %s\n", d.SeqNo, d.Headword)
+	}
+	for _, d := range report.Removed {
+		fmt.Printf("- %d %s\n", d.SeqNo, d.Headword)
+	}
+	for _, d := range report.Modified {
+		fmt.Printf("~ %d %s\n", d.SeqNo, d.Headword)
+		for _, change := range d.Changes {
+			fmt.Printf("    %s\n", change)
+		}
+	}
+	fmt.Printf("%d entries added, %d removed, %d modified\n",
+		len(report.Added), len(report.Removed), len(report.Modified))
+}
+
+func readEntrypack(path string) map[uint64]dictEntry {
+	file, err := os.Open(path)
+	must(err)
+	defer file.Close()
+
+	result := make(map[uint64]dictEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 65536), 16<<20)
+	for scanner.Scan() {
+		if isPackHeader(scanner.Bytes()) {
+			continue
+		}
+		var e dictEntry
+		must(json.Unmarshal(scanner.Bytes(), &e))
+		result[e.SeqNo] = e
+	}
+	must(scanner.Err())
+	return result
+}
+
+func sortedSeqNos(a, b map[uint64]dictEntry) []uint64 {
+	var result []uint64
+	for seqNo := range a {
+		result = append(result, seqNo)
+	}
+	for seqNo := range b {
+		if _, exists := a[seqNo]; !exists {
+			result = append(result, seqNo)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+func headwordOf(e dictEntry) string {
+	if len(e.KEle) > 0 {
+		return e.KEle[0].Keb
+	}
+	if len(e.REle) > 0 {
+		return e.REle[0].Reb
+	}
+	return ""
+}
+
+//describeChanges summarizes the differences between two versions of an entry
+//in a human-readable way. Only the most commonly relevant fields are described
+//in detail; all other changes are reported generically per element.
+func describeChanges(oldEntry, newEntry dictEntry) []string {
+	var changes []string
+
+	kanjiChanges := describeListChange("kanji element", kebsOf(oldEntry), kebsOf(newEntry))
+	if len(kanjiChanges) == 0 && !reflect.DeepEqual(oldEntry.KEle, newEntry.KEle) {
+		kanjiChanges = []string{"changed order, info or priority of kanji elements"}
+	}
+	changes = append(changes, kanjiChanges...)
+
+	readingChanges := describeListChange("reading element", rebsOf(oldEntry), rebsOf(newEntry))
+	if len(readingChanges) == 0 && !reflect.DeepEqual(oldEntry.REle, newEntry.REle) {
+		readingChanges = []string{"changed order, info, priority or restrictions of reading elements"}
+	}
+	changes = append(changes, readingChanges...)
+
+	for idx := 0; idx < len(oldEntry.Sense) || idx < len(newEntry.Sense); idx++ {
+		prefix := fmt.Sprintf("sense %d: ", idx+1)
+		switch {
+		case idx >= len(oldEntry.Sense):
+			changes = append(changes, prefix+"added with glosses: "+strings.Join(glossesOf(newEntry.Sense[idx]), "; "))
+		case idx >= len(newEntry.Sense):
+			changes = append(changes, prefix+"removed with glosses: "+strings.Join(glossesOf(oldEntry.Sense[idx]), "; "))
+		default:
+			oldSense, newSense := oldEntry.Sense[idx], newEntry.Sense[idx]
+			if reflect.DeepEqual(oldSense, newSense) {
+				continue
+			}
+			senseChanges := describeListChange("pos", oldSense.Pos, newSense.Pos)
+			senseChanges = append(senseChanges, describeListChange("gloss", glossesOf(oldSense), glossesOf(newSense))...)
+			if len(senseChanges) == 0 {
+				senseChanges = []string{"changed other fields"}
+			}
+			for _, change := range senseChanges {
+				changes = append(changes, prefix+change)
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		changes = append(changes, "changed other fields")
+	}
+	return changes
+}
+
+//describeListChange reports the values that were added or removed between two
+//lists, e.g. `added gloss "to pull"`.
+func describeListChange(noun string, oldList, newList []string) []string {
+	var changes []string
+	for _, value := range newList {
+		if !containsString(oldList, value) {
+			changes = append(changes, fmt.Sprintf("added %s %q", noun, value))
+		}
+	}
+	for _, value := range oldList {
+		if !containsString(newList, value) {
+			changes = append(changes, fmt.Sprintf("removed %s %q", noun, value))
+		}
+	}
+	return changes
+}
+
+func kebsOf(e dictEntry) []string {
+	var result []string
+	for _, k := range e.KEle {
+		result = append(result, k.Keb)
+	}
+	return result
+}
+
+func rebsOf(e dictEntry) []string {
+	var result []string
+	for _, r := range e.REle {
+		result = append(result, r.Reb)
+	}
+	return result
+}
+
+//glossesOf returns the glosses of a sense as "text (lang)" strings.
+func glossesOf(s dictSense) []string {
+	var result []string
+	for _, g := range s.Gloss {
+		lang := g.Lang
+		if lang == "" {
+			lang = "eng" //default value per DTD
+		}
+		result = append(result, fmt.Sprintf("%s (%s)", g.Text, lang))
+	}
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// checksums for the output (with -write-sha256 and -check-sum)
+
+//writeChecksumFile writes the checksum of the file at path into path +
+//".sha256". The format is the same as for sha256sum, so the result can also be
+//checked with `sha256sum -c`. The file name is stored without directory, so
+//that both files can be moved together.
+func writeChecksumFile(path string, sum []byte) error {
+	contents := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum), filepath.Base(path))
+	return ioutil.WriteFile(stagedPath(path+".sha256"), []byte(contents), 0666)
+}
+
+//checkChecksumFile implements -check-sum. The checked file is looked up in the
+//same directory as the checksum file.
+func checkChecksumFile(checksumPath string) error {
+	buf, err := ioutil.ReadFile(checksumPath)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) != 2 {
+		return fmt.Errorf("%s: expected a line in the format \"<checksum>  <filename>\"", checksumPath)
+	}
+	expected, name := fields[0], strings.TrimPrefix(fields[1], "*")
+	path := filepath.Join(filepath.Dir(checksumPath), name)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	checksum := sha256.New()
+	_, err = io.Copy(checksum, file)
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(checksum.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%s: checksum mismatch: expected SHA-256 %s, got %s", path, expected, actual)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// check an existing entrypack.json (with -verify)
+
+//verifyReport is the result of verifyEntrypack().
+type verifyReport struct {
+	EntryCount           int
+	EntriesWithKanji     int
+	EntriesWithoutSenses int
+	SensesWithoutGlosses int
+	GlossCountByLanguage map[string]int
+	Violations           []string
+}
+
+//verifyEntrypack reads an entrypack in the default format and checks the
+//invariants that the jmdict crate relies on:
+//
+//- Each entry has at least one reading element (this is required by the DTD).
+//- Sequence numbers are unique and in ascending order.
+//
+//Entries without senses (as kept by -langs) and senses without glosses (which
+//occur in the JMdict itself) are allowed, but they are counted in the report
+//since a sudden increase usually indicates a bug in a filter.
+func verifyEntrypack(r io.Reader) (verifyReport, error) {
+	report := verifyReport{GlossCountByLanguage: make(map[string]int)}
+	violation := func(lineNo int, format string, args ...interface{}) {
+		msg := fmt.Sprintf("line %d: ", lineNo) + fmt.Sprintf(format, args...)
+		report.Violations = append(report.Violations, msg)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 65536), 16<<20)
+	var (
+		lineNo    = 0
+		lastSeqNo uint64
+	)
+	for scanner.Scan() {
+		lineNo++
+		if lineNo == 1 && isPackHeader(scanner.Bytes()) {
+			continue
+		}
+		var e dictEntry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			violation(lineNo, "%s", err.Error())
+			continue
+		}
+
+		report.EntryCount++
+		if len(e.KEle) > 0 {
+			report.EntriesWithKanji++
+		}
+		if len(e.Sense) == 0 {
+			report.EntriesWithoutSenses++
+		}
+		if e.Sense == nil {
+			//the schema requires an array, even if it is empty
+			violation(lineNo, "entry %d does not have a list of senses", e.SeqNo)
+		}
+		if len(e.REle) == 0 {
+			violation(lineNo, "entry %d does not have any reading elements", e.SeqNo)
+		}
+		switch {
+		case report.EntryCount == 1:
+		case e.SeqNo == lastSeqNo:
+			violation(lineNo, "entry %d appears more than once", e.SeqNo)
+		case e.SeqNo < lastSeqNo:
+			violation(lineNo, "entry %d comes after entry %d", e.SeqNo, lastSeqNo)
+		}
+		lastSeqNo = e.SeqNo
+		for _, sense := range e.Sense {
+			if len(sense.Gloss) == 0 {
+				report.SensesWithoutGlosses++
+			}
+			for _, gloss := range sense.Gloss {
+				lang := gloss.Lang
+				if lang == "" {
+					lang = "eng" //per DTD
+				}
+				report.GlossCountByLanguage[lang]++
+			}
+		}
+	}
+	return report, scanner.Err()
+}
+
+//Print writes the report in a human-readable form.
+func (r verifyReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d entries, thereof %d with kanji elements and %d without senses\n",
+		r.EntryCount, r.EntriesWithKanji, r.EntriesWithoutSenses)
+	fmt.Fprintf(w, "%d senses without glosses\n", r.SensesWithoutGlosses)
+	for _, lang := range sortedKeys(r.GlossCountByLanguage) {
+		fmt.Fprintf(w, "%d glosses in language %q\n", r.GlossCountByLanguage[lang], lang)
+	}
+	for _, msg := range r.Violations {
+		fmt.Fprintln(w, msg)
+	}
+	if len(r.Violations) > 0 {
+		fmt.Fprintf(w, "found %d violations\n", len(r.Violations))
+	} else {
+		fmt.Fprintln(w, "no violations found")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// convert entrypack.json back into JMdict XML (with -to-xml)
+
+//writeXML converts an entrypack.json back into the XML format of the JMdict, so
+//that edited entries can be submitted upstream. Codes from the entity sets in
+//entities.json (e.g. parts of speech) are written as entity references again.
+//
+//The DTD in the output only contains the entity definitions, but that is
+//enough for this preprocessor to read the result.
+func writeXML(w io.Writer, entrypackPath, entitiesPath string) {
+	sets := readEntitySets(entitiesPath)
+
+	file, err := os.Open(entrypackPath)
+	must(err)
+	defer file.Close()
+
+	out := bufio.NewWriter(w)
+	writeXMLHeader(out, sets)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 65536), 16<<20)
+	for scanner.Scan() {
+		if isPackHeader(scanner.Bytes()) {
+			continue
+		}
+		var e dictEntry
+		must(json.Unmarshal(scanner.Bytes(), &e))
+		must(writeEntryXML(out, e, sets))
+	}
+	must(scanner.Err())
+	out.WriteString("</JMdict>\n")
+	must(out.Flush())
+}
+
+func writeXMLHeader(w *bufio.Writer, sets map[string]map[string]string) {
+	w.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE JMdict [\n")
+	for _, setName := range sortedKeys(sets) {
+		//this format is recognized by processOpening()
+		fmt.Fprintf(w, "<!-- <%s> entities -->\n", setName)
+		for _, key := range sortedKeys(sets[setName]) {
+			fmt.Fprintf(w, "<!ENTITY %s \"%s\">\n", key, sets[setName][key])
+		}
+	}
+	w.WriteString("]>\n<JMdict>\n")
+}
+
+//writeEntryXML writes a single <entry>. The elements appear in the order
+//prescribed by the JMdict DTD, which is also the order of the fields in the
+//dict* types.
+func writeEntryXML(w *bufio.Writer, e dictEntry, sets map[string]map[string]string) error {
+	var err error
+	element := func(name, text string) {
+		fmt.Fprintf(w, "<%s>%s</%s>\n", name, escapeXML(text), name)
+	}
+	entities := func(name string, codes []string) {
+		for _, code := range codes {
+			if _, exists := sets[name][code]; !exists && err == nil {
+				err = fmt.Errorf("entry %d: unknown entity in <%s>: %q", e.SeqNo, name, code)
+			}
+			fmt.Fprintf(w, "<%s>&%s;</%s>\n", name, code, name)
+		}
+	}
+	elements := func(name string, texts []string) {
+		for _, text := range texts {
+			element(name, text)
+		}
+	}
+
+	w.WriteString("<entry>\n")
+	element("ent_seq", strconv.FormatUint(e.SeqNo, 10))
+	for _, k := range e.KEle {
+		w.WriteString("<k_ele>\n")
+		element("keb", k.Keb)
+		entities("ke_inf", k.KeInf)
+		elements("ke_pri", k.KePri)
+		w.WriteString("</k_ele>\n")
+	}
+	for _, r := range e.REle {
+		w.WriteString("<r_ele>\n")
+		element("reb", r.Reb)
+		if r.ReNokanji {
+			w.WriteString("<re_nokanji/>\n")
+		}
+		elements("re_restr", r.ReRestr)
+		entities("re_inf", r.ReInf)
+		elements("re_pri", r.RePri)
+		w.WriteString("</r_ele>\n")
+	}
+	for _, s := range e.Sense {
+		w.WriteString("<sense>\n")
+		elements("stagk", s.Stagk)
+		elements("stagr", s.Stagr)
+		entities("pos", s.Pos)
+		elements("xref", s.Xref)
+		elements("ant", s.Ant)
+		entities("field", s.Field)
+		entities("misc", s.Misc)
+		elements("s_inf", s.SInf)
+		for _, l := range s.Lsource {
+			fmt.Fprintf(w, "<lsource%s>%s</lsource>\n",
+				xmlAttrs("xml:lang", l.Lang, "ls_type", l.LsType, "ls_wasei", l.LsWasei),
+				escapeXML(l.Text))
+		}
+		entities("dial", s.Dial)
+		for _, g := range s.Gloss {
+			fmt.Fprintf(w, "<gloss%s>%s", xmlAttrs("xml:lang", g.Lang, "g_gend", g.GGend, "g_type", g.GType), escapeXML(g.Text))
+			for _, pri := range g.Pri {
+				fmt.Fprintf(w, "<pri>%s</pri>", escapeXML(pri))
+			}
+			w.WriteString("</gloss>\n")
+		}
+		w.WriteString("</sense>\n")
+	}
+	w.WriteString("</entry>\n")
+	return err
+}
+
+//xmlAttrs renders pairs of attribute names and values, skipping empty values.
+func xmlAttrs(pairs ...string) string {
+	var result strings.Builder
+	for idx := 0; idx+1 < len(pairs); idx += 2 {
+		if pairs[idx+1] != "" {
+			fmt.Fprintf(&result, ` %s="%s"`, pairs[idx], escapeXML(pairs[idx+1]))
+		}
+	}
+	return result.String()
+}
+
+func escapeXML(text string) string {
+	var buf bytes.Buffer
+	must(xml.EscapeText(&buf, []byte(text)))
+	return buf.String()
+}
+
+func sortedKeys(m interface{}) []string {
+	var result []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		result = append(result, key.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// generate JSON Schema for the entries in entrypack.json
+
+//writeSchema writes a JSON Schema document describing a single line of
+//entrypack.json. The schema is derived from the dictEntry type and the struct
+//tags of its fields, so it cannot get out of sync with the actual output.
+func writeSchema(path string) {
+	schema := schemaForType(reflect.TypeOf(dictEntry{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "JMdict entry"
+	schema["description"] = "A single entry of the JMdict. Each line of entrypack.json contains one such object."
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) //the descriptions contain XML element names like <keb>
+	enc.SetIndent("", "\t")
+	must(enc.Encode(schema))
+	must(ioutil.WriteFile(path, buf.Bytes(), 0666))
+}
+
+func schemaForType(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Struct:
+		var (
+			properties = make(map[string]interface{})
+			required   = []string{}
+		)
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			key, omitEmpty := fieldKey(field)
+			property := schemaForType(field.Type)
+			if desc := field.Tag.Get("desc"); desc != "" {
+				property["description"] = desc
+			}
+			properties[key] = property
+			if !omitEmpty {
+				required = append(required, key)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		panic("cannot generate JSON Schema for type " + t.String())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// convert the JMnedict into namepack.json (with -jmnedict)
+
+//rootElementName returns the name of the document element of the input file.
+func rootElementName() string {
+	if *jmnedict {
+		return "JMnedict"
+	}
+	return "JMdict"
+}
+
+//jmnedictUnsupportedFlags lists the options that only make sense for the
+//structure of JMdict entries.
+var jmnedictUnsupportedFlags = []string{
+	"langs", "merge-glosses", "min-priority", "only-seqs", "pos", "pretty-debug",
+	"report-duplicate-glosses", "self-check", "seq-max", "seq-min", "shard-max-bytes",
+	"strict-lang", "transform",
+}
+
+//nameEntry is the counterpart of dictEntry for the JMnedict. The kanji and
+//reading elements have the same structure as in the JMdict, but instead of
+//senses, there are translations that describe what kind of name this is.
+type nameEntry struct {
+	SeqNo uint64      `xml:"ent_seq" json:"n" desc:"sequence number of this entry (<ent_seq>)" verbose:"sequence"`
+	KEle  []dictKEle  `xml:"k_ele" json:"K,omitempty" desc:"kanji elements (<k_ele>)" verbose:"kanji"`
+	REle  []dictREle  `xml:"r_ele" json:"R" desc:"reading elements (<r_ele>), at least one" verbose:"readings"`
+	Trans []nameTrans `xml:"trans" json:"T" desc:"translations (<trans>)" verbose:"translations"`
+}
+
+type nameTrans struct {
+	NameType []string       `xml:"name_type" json:"t,omitempty" desc:"name type codes like \"surname\" (<name_type>)" verbose:"name_types"`
+	Xref     []string       `xml:"xref" json:"xref,omitempty" desc:"cross-references to related entries (<xref>)" verbose:"cross_references"`
+	TransDet []nameTransDet `xml:"trans_det" json:"G,omitempty" desc:"translations of the name (<trans_det>)" verbose:"glosses"`
+}
+
+type nameTransDet struct {
+	Text string `xml:",chardata" json:"t" desc:"text of this translation" verbose:"text"`
+	Lang string `xml:"lang,attr" json:"l,omitempty" desc:"ISO 639-2/B code of the language of this translation, \"eng\" if omitted" verbose:"language"`
+}
+
+//processNames is the counterpart of processEntries() for the JMnedict. It
+//writes namepack.json (or outputPath), starting with the same header line as
+//entrypack.json. The JMnedict is much smaller than the JMdict, and none of the
+//filters and transforms apply to it.
+func processNames(nextLine func() string, header packHeader, outputPath string) {
+	if outputPath == "" {
+		outputPath = "namepack.json"
+	}
+	var outputFile io.Writer = os.Stdout
+	if outputPath != "-" {
+		file, err := os.Create(stagedPath(outputPath))
+		must(err)
+		defer file.Close()
+		outputFile = file
+	}
+	var checksum hash.Hash
+	if *writeSHA256 {
+		checksum = sha256.New()
+		outputFile = io.MultiWriter(outputFile, checksum)
+	}
+	output := entryWriter{
+		Writer:  outputFile,
+		AsArray: *outputFormat == "json-array",
+		Pretty:  *prettyPrint,
+	}
+	must(output.Begin())
+	headerBytes, err := json.Marshal(header)
+	must(err)
+	must(output.Write(string(headerBytes) + "\n"))
+
+	names := newEntryDecoder(nextLine)
+	for {
+		var e nameEntry
+		ok, err := names.Next(&e)
+		if !ok {
+			break
+		}
+		var jsonStr string
+		if err == nil {
+			jsonStr, err = processName(e)
+		}
+		if err != nil {
+			panic(describeEntryError(names.Count, names.Snippet(), err))
+		}
+		must(output.Write(jsonStr))
+	}
+	must(output.Finish())
+	if checksum != nil {
+		must(writeChecksumFile(outputPath, checksum.Sum(nil)))
+	}
+
+	reportUnknownEntities(os.Stderr)
+	if len(unknownEntities) > 0 {
+		panic("found values without entity definitions (see above)")
+	}
+}
+
+//processName converts a single decoded <entry> of the JMnedict into a line of
+//JSON.
+func processName(e nameEntry) (string, error) {
+	if len(e.REle) == 0 {
+		//the DTD requires at least one <r_ele>
+		return "", fmt.Errorf("entry %d does not have any <r_ele>", e.SeqNo)
+	}
+	collectUnknownNameEntities(e)
+
+	var (
+		jsonBytes []byte
+		err       error
+	)
+	if *verboseKeys {
+		jsonBytes, err = marshalVerbose(reflect.ValueOf(e))
+	} else {
+		jsonBytes, err = json.Marshal(e)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes) + "\n", nil
+}
+
+//collectUnknownNameEntities is the counterpart of collectUnknownEntities() for
+//the JMnedict.
+func collectUnknownNameEntities(e nameEntry) {
+	for _, k := range e.KEle {
+		collectUnknownEntityValues("ke_inf", k.KeInf, e.SeqNo)
+	}
+	for _, r := range e.REle {
+		collectUnknownEntityValues("re_inf", r.ReInf, e.SeqNo)
+	}
+	for _, trans := range e.Trans {
+		collectUnknownEntityValues("name_type", trans.NameType, e.SeqNo)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,1150 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var updateGolden = flag.Bool("update", false, "in TestProcessEntryGolden, overwrite the golden files with the actual output")
+
+//Seeds for FuzzProcessEntry. These are taken from the actual JMdict and cover
+//the more unusual parts of the schema.
+var seedEntries = []string{
+	//restrictions (<re_restr>, <stagk>, <stagr>) and <re_nokanji>
+	`<entry>
+<ent_seq>1000320</ent_seq>
+<k_ele><keb>彼処</keb><ke_pri>ichi1</ke_pri></k_ele>
+<k_ele><keb>彼所</keb></k_ele>
+<r_ele><reb>あそこ</reb><re_pri>ichi1</re_pri></r_ele>
+<r_ele><reb>あすこ</reb></r_ele>
+<r_ele><reb>かしこ</reb><re_restr>彼処</re_restr></r_ele>
+<r_ele><reb>アソコ</reb><re_nokanji/></r_ele>
+<sense><stagk>彼処</stagk><stagk>彼所</stagk><pos>&pn;</pos><xref>何処</xref><misc>&uk;</misc><gloss>there</gloss></sense>
+<sense><stagr>あそこ</stagr><pos>&n;</pos><misc>&col;</misc><gloss>genitals</gloss></sense>
+</entry>`,
+	//<lsource> with all attributes, and <ke_inf>/<re_inf>
+	`<entry>
+<ent_seq>1049180</ent_seq>
+<r_ele><reb>コーヒー</reb><re_pri>ichi1</re_pri></r_ele>
+<r_ele><reb>コーヒ</reb><re_inf>&ik;</re_inf></r_ele>
+<k_ele><keb>珈琲</keb><ke_inf>&ateji;</ke_inf></k_ele>
+<sense><pos>&n;</pos><lsource xml:lang="dut">koffie</lsource><gloss>coffee</gloss></sense>
+<sense><lsource xml:lang="eng" ls_type="part" ls_wasei="y">sub</lsource><lsource xml:lang="ger" ls_type="part">Rucksack</lsource><gloss xml:lang="ger">Kaffee</gloss></sense>
+</entry>`,
+	//<xref>, <ant>, <field>, <dial>, <s_inf>, <gloss g_type> and <example>
+	`<entry>
+<ent_seq>1000200</ent_seq>
+<k_ele><keb>引く</keb></k_ele>
+<r_ele><reb>ひく</reb></r_ele>
+<sense><pos>&v5k;</pos><pos>&vt;</pos><xref>引き・1</xref><ant>押す</ant><field>&comp;</field><dial>&ksb;</dial><s_inf>usu. in the passive</s_inf><gloss g_type="fig">to attract</gloss>
+<example><ex_srce exsrc_type="tat">12345</ex_srce><ex_text>引く</ex_text><ex_sent xml:lang="jpn">綱を引く。</ex_sent><ex_sent xml:lang="eng">Pull the rope.</ex_sent></example>
+</sense>
+</entry>`,
+	//entry without <r_ele> (must be rejected)
+	`<entry><ent_seq>1000100</ent_seq><k_ele><keb>ＡＢＣ順</keb></k_ele><sense><gloss>alphabetical order</gloss></sense></entry>`,
+}
+
+func registerTestEntities() {
+	//normally, processOpening() fills this from the DTD
+	for _, entity := range []string{"pn", "n", "uk", "col", "ik", "ateji", "v5k", "vt", "comp", "ksb", "arch", "hon", "v1", "ok"} {
+		decoderEntities[entity] = entity
+	}
+}
+
+func TestMarshalEntitySets(t *testing.T) {
+	//the output must be the same no matter in which order the sets and
+	//entities were inserted
+	expected := `{
+	"misc": {
+		"arch": "archaic",
+		"col": "colloquial",
+		"hon": "honorific or respectful (sonkeigo) language"
+	},
+	"pos": {
+		"n": "noun (common) (futsuumeishi)",
+		"v1": "Ichidan verb"
+	}
+}`
+	for run := 0; run < 10; run++ {
+		sets := make(map[string]map[string]string)
+		sets["pos"] = map[string]string{"v1": "Ichidan verb"}
+		sets["misc"] = map[string]string{"hon": "honorific or respectful (sonkeigo) language", "col": "colloquial"}
+		sets["pos"]["n"] = "noun (common) (futsuumeishi)"
+		sets["misc"]["arch"] = "archaic"
+
+		actual, err := marshalEntitySets(sets)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(actual) != expected {
+			t.Fatalf("expected %q, got %q", expected, string(actual))
+		}
+	}
+
+	//the format must stay the same as for existing entities.json files, which
+	//were written by marshaling the maps directly
+	sets := map[string]map[string]string{
+		"field": {},
+		"misc":  {"uk": "word usually written using kana alone", "x": "rude or X-rated term (not displayed in educational software)"},
+		"pos":   {"adj-f": "noun or verb acting prenominally", "n-pr": "proper noun <&>"},
+	}
+	actual, err := marshalEntitySets(sets)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	buf, err := json.Marshal(sets)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf, "", "\t"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(actual) != indented.String() {
+		t.Errorf("expected %q, got %q", indented.String(), string(actual))
+	}
+}
+
+func TestLoadDecoderEntities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "entities")
+	must(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entities.json")
+	must(ioutil.WriteFile(path, []byte(`{"pos":{"adj-pn":"pre-noun adjectival"},"misc":{"yoji":"yojijukugo"}}`), 0666))
+
+	header := loadDecoderEntities(path)
+	if header.Version != 1 || len(header.Schema) != 0 {
+		t.Errorf("unexpected header: %#v", header)
+	}
+	jsonStr, err := processEntry(`<entry><ent_seq>1</ent_seq><r_ele><reb>この</reb></r_ele>` +
+		`<sense><pos>&adj-pn;</pos><misc>&yoji;</misc><gloss>this</gloss></sense></entry>`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"n":1,"R":[{"t":"この"}],"S":[{"p":["adj-pn"],"m":["yoji"],"G":[{"t":"this"}]}]}` + "\n"
+	if jsonStr != expected {
+		t.Errorf("expected %q, got %q", expected, jsonStr)
+	}
+}
+
+func TestProcessEntrySeeds(t *testing.T) {
+	//make sure that the seeds exercise the successful path, except for the last one
+	registerTestEntities()
+	for idx, seed := range seedEntries {
+		_, err := processEntry(seed)
+		expectSuccess := idx < len(seedEntries)-1
+		if expectSuccess && err != nil {
+			t.Errorf("seed #%d: unexpected error: %s", idx, err.Error())
+		}
+		if !expectSuccess && err == nil {
+			t.Errorf("seed #%d: expected error, got success", idx)
+		}
+	}
+}
+
+//Inputs for TestProcessEntryGolden. The expected output for each case is in
+//testdata/$NAME.golden.json.
+var goldenEntries = []struct {
+	Name string
+	XML  string
+}{
+	{"restrictions", seedEntries[0]},
+	{"lsource-wasei", seedEntries[1]},
+	{"xrefs-and-examples", seedEntries[2]},
+	//<misc>, <s_inf>, glosses in several languages, and a sense without <pos>
+	{"misc-and-languages", `<entry>
+<ent_seq>1002650</ent_seq>
+<k_ele><keb>お母さん</keb><ke_pri>ichi1</ke_pri><ke_pri>news1</ke_pri><ke_pri>nf03</ke_pri></k_ele>
+<r_ele><reb>おかあさん</reb><re_pri>ichi1</re_pri><re_pri>news1</re_pri><re_pri>nf03</re_pri></r_ele>
+<sense><pos>&n;</pos><misc>&hon;</misc><s_inf>also used as a term of address</s_inf><gloss>mother</gloss><gloss>mom</gloss>
+<gloss xml:lang="dut">moeder</gloss><gloss xml:lang="ger">Mutter</gloss><gloss xml:lang="rus">мама</gloss></sense>
+<sense><misc>&arch;</misc><gloss g_type="expl">wife of a merchant</gloss></sense>
+</entry>`},
+	//kana-only entry with <re_inf>
+	{"kana-only", `<entry>
+<ent_seq>1000230</ent_seq>
+<r_ele><reb>いる</reb><re_pri>ichi1</re_pri></r_ele>
+<r_ele><reb>ゐる</reb><re_inf>&ok;</re_inf></r_ele>
+<sense><pos>&v1;</pos><misc>&uk;</misc><gloss>to be</gloss><gloss>to exist</gloss></sense>
+</entry>`},
+}
+
+func TestProcessEntryGolden(t *testing.T) {
+	//When the type definitions or struct tags change, run `go test *.go -update`
+	//and review the diff of the golden files.
+	registerTestEntities()
+	for _, tc := range goldenEntries {
+		path := filepath.Join("testdata", tc.Name+".golden.json")
+		actual, err := processEntry(tc.XML)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.Name, err.Error())
+			continue
+		}
+
+		if *updateGolden {
+			must(ioutil.WriteFile(path, []byte(actual), 0666))
+			continue
+		}
+		expected, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s: cannot read golden file (run with -update to create it): %s", tc.Name, err.Error())
+			continue
+		}
+		if actual != string(expected) {
+			t.Errorf("%s: output does not match %s\nexpected: %s\n  actual: %s", tc.Name, path, expected, actual)
+		}
+	}
+}
+
+func FuzzProcessEntry(f *testing.F) {
+	registerTestEntities()
+	for _, seed := range seedEntries {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, xmlStr string) {
+		//the only requirement is that processEntry does not panic, and that it
+		//returns a single line of valid JSON if it succeeds
+		jsonStr, err := processEntry(xmlStr)
+		if err != nil {
+			return
+		}
+		if !strings.HasSuffix(jsonStr, "\n") || strings.Count(jsonStr, "\n") != 1 {
+			t.Errorf("expected a single line of JSON, got %q", jsonStr)
+		}
+		if !json.Valid([]byte(jsonStr)) {
+			t.Errorf("got invalid JSON: %q", jsonStr)
+		}
+	})
+}
+
+func TestProcessEntries(t *testing.T) {
+	registerTestEntities()
+	entitySets = nil
+	unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+
+	//processEntries decodes all entries from one stream, but the result must be
+	//the same as with processEntry on each entry
+	header := packHeader{Version: 1, Schema: []string{}}
+	headerBytes, err := json.Marshal(header)
+	must(err)
+	expected := string(headerBytes) + "\n"
+	var lines []string
+	for _, seed := range seedEntries {
+		jsonStr, err := processEntry(seed)
+		if err == nil {
+			expected += jsonStr
+			lines = append(lines, strings.Split(seed, "\n")...)
+			lines = append(lines, "<!-- comments between entries are ignored -->")
+		}
+	}
+	lines = append(lines, "</JMdict>", "this line must not be read")
+
+	dir, err := ioutil.TempDir("", "entries")
+	must(err)
+	defer os.RemoveAll(dir)
+	outputPath := filepath.Join(dir, "entrypack.json")
+	idx := 0
+	processEntries(func() string {
+		idx++
+		return strings.TrimSpace(lines[idx-1])
+	}, header, outputPath)
+
+	if idx != len(lines)-1 {
+		t.Errorf("expected processEntries to stop reading after </JMdict>, but it read %d of %d lines", idx, len(lines))
+	}
+	actual, err := ioutil.ReadFile(outputPath)
+	must(err)
+	if string(actual) != expected {
+		t.Errorf("expected %q, got %q", expected, string(actual))
+	}
+}
+
+func TestMaxEntryBytes(t *testing.T) {
+	registerTestEntities()
+	entitySets = nil
+	unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+	defaultMaxEntryBytes := *maxEntryBytes
+	defer func() { *maxEntryBytes = defaultMaxEntryBytes }()
+	*maxEntryBytes = 1000
+
+	//after a valid entry, the second entry is missing its </entry> and the
+	//input never ends, so this only terminates if the limit is enforced while
+	//reading
+	lines := strings.Split(seedEntries[0], "\n")
+	lines = append(lines, "<entry>", "<ent_seq>2000000</ent_seq>")
+	lastSeqNo := entSeqRx.FindStringSubmatch(seedEntries[0])[1]
+
+	dir, err := ioutil.TempDir("", "entries")
+	must(err)
+	defer os.RemoveAll(dir)
+	idx := 0
+	message := func() (message string) {
+		defer func() { message = fmt.Sprint(recover()) }()
+		processEntries(func() string {
+			idx++
+			if idx > len(lines) {
+				return "<gloss>filler</gloss>"
+			}
+			return strings.TrimSpace(lines[idx-1])
+		}, packHeader{Version: 1, Schema: []string{}}, filepath.Join(dir, "entrypack.json"))
+		return ""
+	}()
+
+	expected := "entry is larger than 1000 bytes (missing </entry>?), last complete entry was ent_seq " + lastSeqNo
+	if !strings.Contains(message, expected) {
+		t.Errorf("expected panic with %q, got %q", expected, message)
+	}
+	if idx > len(lines)+1000/len("<gloss>filler</gloss>")+1 {
+		t.Errorf("expected reading to stop at the limit, but %d lines were read", idx)
+	}
+}
+
+func TestProcessNames(t *testing.T) {
+	*jmnedict = true
+	entitySets = nil
+	unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+	defer func() { *jmnedict = false }()
+	decoderEntities["surname"] = "surname"
+	decoderEntities["place"] = "place"
+
+	input := `<entry>
+<ent_seq>5000000</ent_seq>
+<k_ele><keb>ゝ泉</keb></k_ele>
+<r_ele><reb>こいずみ</reb></r_ele>
+<trans><name_type>&surname;</name_type><trans_det>Koizumi</trans_det></trans>
+</entry>
+<entry>
+<ent_seq>5741815</ent_seq>
+<k_ele><keb>東京</keb></k_ele>
+<r_ele><reb>とうきょう</reb></r_ele>
+<trans><name_type>&place;</name_type><trans_det>Tokyo</trans_det><trans_det xml:lang="ger">Tokio</trans_det></trans>
+</entry>
+</JMnedict>`
+	lines := strings.Split(input, "\n")
+
+	dir, err := ioutil.TempDir("", "names")
+	must(err)
+	defer os.RemoveAll(dir)
+	outputPath := filepath.Join(dir, "namepack.json")
+	idx := 0
+	processNames(func() string {
+		idx++
+		return lines[idx-1]
+	}, packHeader{Version: 1, Schema: []string{}, JMdictDate: "2023-07-24"}, outputPath)
+
+	expected := `{"v":1,"schema":[],"jmdict_date":"2023-07-24"}
+{"n":5000000,"K":[{"t":"ゝ泉"}],"R":[{"t":"こいずみ"}],"T":[{"t":["surname"],"G":[{"t":"Koizumi"}]}]}
+{"n":5741815,"K":[{"t":"東京"}],"R":[{"t":"とうきょう"}],"T":[{"t":["place"],"G":[{"t":"Tokyo"},{"t":"Tokio","l":"ger"}]}]}
+`
+	actual, err := ioutil.ReadFile(outputPath)
+	must(err)
+	if string(actual) != expected {
+		t.Errorf("expected %q, got %q", expected, string(actual))
+	}
+}
+
+//BenchmarkProcessEntries converts a few thousand copies of the valid seed
+//entries, e.g. `go test -bench ProcessEntries -benchtime 10x *.go`.
+func BenchmarkProcessEntries(b *testing.B) {
+	registerTestEntities()
+	entitySets = nil
+	unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+	var lines []string
+	for idx := 0; idx < 1000; idx++ {
+		for _, seed := range seedEntries {
+			if _, err := processEntry(seed); err == nil {
+				lines = append(lines, strings.Split(seed, "\n")...)
+			}
+		}
+	}
+	lines = append(lines, "</JMdict>")
+
+	dir, err := ioutil.TempDir("", "bench")
+	must(err)
+	defer os.RemoveAll(dir)
+	outputPath := filepath.Join(dir, "entrypack.json")
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		idx := 0
+		processEntries(func() string {
+			idx++
+			return strings.TrimSpace(lines[idx-1])
+		}, packHeader{Version: 1, Schema: []string{}}, outputPath)
+	}
+}
+
+func TestFixtureFilters(t *testing.T) {
+	for _, tc := range []struct {
+		SeqNo, Min, Max uint64
+		Expected        bool
+	}{
+		{1000100, 0, 0, true},
+		{1000100, 1000100, 1000100, true},
+		{1000100, 1000200, 0, false},
+		{1000300, 0, 1000200, false},
+		{1000150, 1000100, 1000200, true},
+	} {
+		if isInSeqNoRange(tc.SeqNo, tc.Min, tc.Max) != tc.Expected {
+			t.Errorf("expected isInSeqNoRange(%d, %d, %d) = %t", tc.SeqNo, tc.Min, tc.Max, tc.Expected)
+		}
+	}
+
+	codes := parsePartsOfSpeech("v1, v5k")
+	e := dictEntry{
+		SeqNo: 1000200,
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{{Pos: []string{"n"}}, {Pos: []string{"v5k", "vt"}}, {}},
+	}
+	if !hasAnyPartOfSpeech(e, codes) {
+		t.Error("expected entry to match -pos=v1,v5k")
+	}
+	e.Sense[1].Pos = []string{"vt"}
+	if hasAnyPartOfSpeech(e, codes) {
+		t.Error("expected entry to not match -pos=v1,v5k")
+	}
+
+	entitySets = map[string]map[string]string{"pos": {"v1": "Ichidan verb", "v5k": "Godan verb with 'ku' ending"}}
+	defer func() { entitySets = nil }()
+	if err := checkPartsOfSpeech(codes); err != nil {
+		t.Error(err.Error())
+	}
+	if checkPartsOfSpeech(parsePartsOfSpeech("v1,v6")) == nil {
+		t.Error("expected unknown part of speech to be rejected")
+	}
+}
+
+func TestDescribeChanges(t *testing.T) {
+	oldEntry := dictEntry{
+		SeqNo: 1000200,
+		KEle:  []dictKEle{{Keb: "引く"}},
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{{Pos: []string{"v5k"}, Gloss: []dictGloss{{Text: "to pull"}}}},
+	}
+	newEntry := dictEntry{
+		SeqNo: 1000200,
+		KEle:  []dictKEle{{Keb: "引く", KePri: []string{"ichi1"}}},
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{
+			{Pos: []string{"v5k", "vt"}, Gloss: []dictGloss{{Text: "to pull"}, {Text: "ziehen", Lang: "ger"}}},
+			{Gloss: []dictGloss{{Text: "to subtract"}}},
+		},
+	}
+
+	expected := []string{
+		"changed order, info or priority of kanji elements",
+		`sense 1: added pos "vt"`,
+		`sense 1: added gloss "ziehen (ger)"`,
+		"sense 2: added with glosses: to subtract (eng)",
+	}
+	actual := describeChanges(oldEntry, newEntry)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v", expected, actual)
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	e := dictEntry{
+		SeqNo: 1000300,
+		KEle:  []dictKEle{{Keb: "珈琲"}},
+		REle:  []dictREle{{Reb: "コーヒー", RePri: []string{"ichi1"}}},
+		Sense: []dictSense{
+			{Xref: []string{"カフェ"}, Gloss: []dictGloss{{Text: "coffee"}, {Text: "Kaffee", Lang: "ger"}}},
+			{Gloss: []dictGloss{{Text: "koffie", Lang: "dut"}}},
+		},
+	}
+
+	if !transformCommonOnly(&e) || len(e.KEle) != 0 || len(e.REle) != 1 {
+		t.Errorf("common-only: unexpected result %#v", e)
+	}
+	if !transformDropXrefs(&e) || e.Sense[0].Xref != nil {
+		t.Errorf("drop-xrefs: unexpected result %#v", e)
+	}
+	if !transformEnglishOnly(&e) || len(e.Sense) != 1 || len(e.Sense[0].Gloss) != 1 {
+		t.Errorf("english-only: unexpected result %#v", e)
+	}
+
+	//entries are dropped when nothing remains
+	e.REle[0].RePri = nil
+	if transformCommonOnly(&e) {
+		t.Error("common-only: expected entry without common readings to be dropped")
+	}
+}
+
+func TestMinPriority(t *testing.T) {
+	testCases := []struct {
+		KePri    []string
+		RePri    []string
+		Expected bool
+	}{
+		{nil, nil, false},
+		{nil, []string{"ichi1"}, true},
+		{[]string{"gai1"}, nil, true},
+		{[]string{"news2", "nf30"}, []string{"spec2"}, false},
+		{[]string{"news1", "nf30"}, nil, true},
+		{[]string{"nf10"}, nil, true},
+		{[]string{"nf11"}, []string{"nf12"}, false},
+	}
+	for _, tc := range testCases {
+		e := dictEntry{
+			KEle: []dictKEle{{Keb: "漢字", KePri: tc.KePri}},
+			REle: []dictREle{{Reb: "かんじ", RePri: tc.RePri}},
+		}
+		if hasPriorityAtLeast(e, 10) != tc.Expected {
+			t.Errorf("with ke_pri %v and re_pri %v: expected %t", tc.KePri, tc.RePri, tc.Expected)
+		}
+	}
+}
+
+func TestFilterGlossLanguages(t *testing.T) {
+	knownGlossLanguages = readKnownGlossLanguages(*languagesPath)
+	langs, err := parseGlossLanguages("eng, GER")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(langs, map[string]bool{"eng": true, "ger": true}) {
+		t.Errorf("unexpected result from parseGlossLanguages: %v", langs)
+	}
+	_, err = parseGlossLanguages("eng,en")
+	if err == nil || !strings.HasPrefix(err.Error(), `unknown language "en" in -langs`) {
+		t.Errorf("expected parseGlossLanguages to reject \"en\", got %v", err)
+	}
+
+	e := dictEntry{
+		SeqNo: 1000200,
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{
+			{Pos: []string{"v5k"}, Gloss: []dictGloss{{Text: "to pull"}, {Text: "ziehen", Lang: "ger"}}},
+			{Gloss: []dictGloss{{Text: "trekken", Lang: "dut"}}},
+		},
+	}
+	filterGlossLanguages(&e, map[string]bool{"eng": true})
+	expected := []dictSense{{Pos: []string{"v5k"}, Gloss: []dictGloss{{Text: "to pull"}}}}
+	if !reflect.DeepEqual(e.Sense, expected) {
+		t.Errorf("expected senses %#v, got %#v", expected, e.Sense)
+	}
+
+	//entries without senses are kept, and still have a list of senses
+	filterGlossLanguages(&e, map[string]bool{"fre": true})
+	if len(e.Sense) != 0 || len(e.REle) != 1 {
+		t.Errorf("expected entry without senses, got %#v", e)
+	}
+	jsonStr, err := encodeEntry(e)
+	must(err)
+	expectedJSON := `{"n":1000200,"R":[{"t":"ひく"}],"S":[]}` + "\n"
+	if jsonStr != expectedJSON {
+		t.Errorf("expected %q, got %q", expectedJSON, jsonStr)
+	}
+}
+
+func TestMergeGlosses(t *testing.T) {
+	lang, path, err := parseMergeGlossesSpec("ita:/tmp/glosses.json")
+	if lang != "ita" || path != "/tmp/glosses.json" || err != nil {
+		t.Errorf("unexpected result from parseMergeGlossesSpec: %q, %q, %v", lang, path, err)
+	}
+	_, _, err = parseMergeGlossesSpec("glosses.json")
+	if err == nil {
+		t.Error("expected parseMergeGlossesSpec to fail without a language")
+	}
+
+	input := `{"1000100": [["mano", "arto"], []], "1000200": [["tirare"]], "1000300": [["nuovo"]]}`
+	supplement, err := readGlossSupplement("ita", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//glosses are added as new senses (empty senses are skipped)
+	e := dictEntry{
+		SeqNo: 1000100,
+		REle:  []dictREle{{Reb: "て"}},
+		Sense: []dictSense{{Pos: []string{"n"}, Gloss: []dictGloss{{Text: "hand"}}}},
+	}
+	if !supplement.mergeInto(&e) {
+		t.Error("expected merge into entry 1000100 to succeed")
+	}
+	expected := []dictSense{
+		{Pos: []string{"n"}, Gloss: []dictGloss{{Text: "hand"}}},
+		{Gloss: []dictGloss{{Text: "mano", Lang: "ita"}, {Text: "arto", Lang: "ita"}}},
+	}
+	if !reflect.DeepEqual(e.Sense, expected) {
+		t.Errorf("expected senses %#v, got %#v", expected, e.Sense)
+	}
+
+	//entries that already have glosses in this language are not changed
+	e = dictEntry{
+		SeqNo: 1000200,
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{{Gloss: []dictGloss{{Text: "tirare", Lang: "ita"}}}},
+	}
+	if supplement.mergeInto(&e) {
+		t.Error("expected merge into entry 1000200 to report a conflict")
+	}
+	if len(e.Sense) != 1 {
+		t.Errorf("expected entry 1000200 to be unchanged, got %#v", e.Sense)
+	}
+
+	var buf bytes.Buffer
+	supplement.reportUnused(&buf)
+	expectedReport := "-merge-glosses: 1 entries with glosses in \"ita\" were not found in the input\n"
+	if buf.String() != expectedReport {
+		t.Errorf("expected report %q, got %q", expectedReport, buf.String())
+	}
+}
+
+func TestMaybeGunzip(t *testing.T) {
+	input := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<JMdict>\n</JMdict>\n"
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err := w.Write([]byte(input))
+	must(err)
+	must(w.Close())
+
+	for _, buf := range [][]byte{[]byte(input), compressed.Bytes()} {
+		actual, err := ioutil.ReadAll(maybeGunzip(bytes.NewReader(buf)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(actual) != input {
+			t.Errorf("expected %q, got %q", input, string(actual))
+		}
+	}
+}
+
+func TestCheckInputLine(t *testing.T) {
+	testCases := []struct {
+		Line     string
+		LineNo   int
+		Expected string
+		Error    string
+	}{
+		{"<?xml version=\"1.0\"?>\n", 1, "<?xml version=\"1.0\"?>\n", ""},
+		{"\uFEFF<?xml version=\"1.0\"?>\n", 1, "<?xml version=\"1.0\"?>\n", ""},
+		//a BOM is only stripped at the start of the file
+		{"\uFEFF<entry>\n", 2, "\uFEFF<entry>\n", ""},
+		{"<reb>\x82\xa0</reb>\n", 42, "", "line 42 of the input is not valid UTF-8 (was the file re-encoded?)"},
+	}
+	for _, tc := range testCases {
+		actual, err := checkInputLine(tc.Line, tc.LineNo)
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if actual != tc.Expected || errMsg != tc.Error {
+			t.Errorf("for line %d %q: expected %q and error %q, got %q and error %q",
+				tc.LineNo, tc.Line, tc.Expected, tc.Error, actual, errMsg)
+		}
+	}
+}
+
+func TestDescribeEntryError(t *testing.T) {
+	xmlStr := "<entry><ent_seq>1514020</ent_seq><r_ele><reb>&unknown;</reb></r_ele></entry>"
+	_, err := processEntry(xmlStr)
+	if err == nil {
+		t.Fatal("expected processEntry to fail on unknown entity")
+	}
+	actual := describeEntryError(48213, xmlStr, err)
+	expected := "entry #48213 (ent_seq 1514020): " + err.Error() + "\nin: " + xmlStr
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	//long entries are truncated, but not in the middle of a character
+	xmlStr = "<entry>" + strings.Repeat("あ", 200) + "</entry>"
+	actual = describeEntryError(1, xmlStr, err)
+	if !strings.HasPrefix(actual, "entry #1 (ent_seq unknown): ") {
+		t.Errorf("unexpected prefix in %q", actual)
+	}
+	snippet := actual[strings.Index(actual, "\nin: ")+5:]
+	if !strings.HasSuffix(snippet, "...") || len(snippet) > maxErrorSnippetBytes+3 || !utf8.ValidString(snippet) {
+		t.Errorf("snippet was not truncated correctly: %q", snippet)
+	}
+}
+
+func TestSeqNoAllowList(t *testing.T) {
+	input := "1000100\n\n# comment\n 1000300 # trailing comment\n"
+	actual, err := readSeqNoAllowList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[uint64]bool{1000100: false, 1000300: false}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	_, err = readSeqNoAllowList(strings.NewReader("1000100\nfoo\n"))
+	if err == nil || err.Error() != `line 2: invalid sequence number "foo"` {
+		t.Errorf("expected error for invalid sequence number, got %v", err)
+	}
+}
+
+func TestUnknownGlossLanguages(t *testing.T) {
+	knownGlossLanguages = readKnownGlossLanguages(*languagesPath)
+	unknownGlossLanguages = make(map[string]*unknownLanguageStats)
+	defer func() { unknownGlossLanguages = make(map[string]*unknownLanguageStats) }()
+
+	for seqNo := uint64(1); seqNo <= 7; seqNo++ {
+		collectUnknownGlossLanguages(dictEntry{
+			SeqNo: seqNo,
+			REle:  []dictREle{{Reb: "て"}},
+			Sense: []dictSense{{Gloss: []dictGloss{
+				{Text: "hand"},
+				{Text: "Hand", Lang: "ger"},
+				{Text: "mano", Lang: "ita"},
+				{Text: "manus", Lang: "ita"},
+			}}},
+		})
+	}
+	collectUnknownGlossLanguages(dictEntry{
+		SeqNo: 8,
+		REle:  []dictREle{{Reb: "て"}},
+		Sense: []dictSense{{Gloss: []dictGloss{{Text: "hand", Lang: "en"}}}},
+	})
+
+	var buf bytes.Buffer
+	reportUnknownGlossLanguages(&buf)
+	expected := `found 1 glosses in unknown language "en", e.g. in entries 8
+found 14 glosses in unknown language "ita", e.g. in entries 1, 2, 3, 4, 5
+`
+	if buf.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, buf.String())
+	}
+}
+
+func TestUnknownEntities(t *testing.T) {
+	unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+	entitySets = map[string]map[string]string{
+		"pos":  {"n": "noun (common) (futsuumeishi)", "vt": "transitive verb"},
+		"misc": {"arch": "archaic"},
+	}
+	defer func() {
+		entitySets = nil
+		unknownEntities = make(map[unknownEntityKey]*unknownEntityStats)
+	}()
+
+	collectUnknownEntities(dictEntry{
+		SeqNo: 1,
+		KEle:  []dictKEle{{Keb: "手", KeInf: []string{"ateji"}}},
+		REle:  []dictREle{{Reb: "て"}},
+		Sense: []dictSense{{
+			Pos:   []string{"n", "v9z"},
+			Misc:  []string{"arch", "vt"},
+			Gloss: []dictGloss{{Text: "hand"}},
+		}},
+	})
+	collectUnknownEntities(dictEntry{
+		SeqNo: 2,
+		REle:  []dictREle{{Reb: "て"}},
+		Sense: []dictSense{{Pos: []string{"v9z"}}, {Pos: []string{"v9z"}}},
+	})
+
+	var buf bytes.Buffer
+	reportUnknownEntities(&buf)
+	expected := `found 1 uses of <ke_inf>ateji</ke_inf> without entity definition, e.g. in entries 1
+found 1 uses of <misc>vt</misc> without entity definition, e.g. in entries 1
+found 3 uses of <pos>v9z</pos> without entity definition, e.g. in entries 1, 2
+`
+	if buf.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, buf.String())
+	}
+}
+
+func TestExpandEntities(t *testing.T) {
+	entitySets = map[string]map[string]string{
+		"pos":  {"v5k": "Godan verb with 'ku' ending", "vt": "transitive verb"},
+		"misc": {"arch": "archaic"},
+	}
+	defer func() { entitySets = nil }()
+
+	e := dictEntry{
+		SeqNo: 1000200,
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{{
+			Pos:   []string{"v5k", "vt"},
+			Misc:  []string{"arch", "unknown"},
+			Gloss: []dictGloss{{Text: "to pull"}},
+		}},
+	}
+	actual := expandEntities(e)
+	expected := dictEntry{
+		SeqNo: 1000200,
+		REle:  []dictREle{{Reb: "ひく"}},
+		Sense: []dictSense{{
+			Pos:   []string{"Godan verb with 'ku' ending", "transitive verb"},
+			Misc:  []string{"archaic", "unknown"},
+			Gloss: []dictGloss{{Text: "to pull"}},
+		}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v", expected, actual)
+	}
+	//the original entry must not be changed
+	if e.Sense[0].Pos[0] != "v5k" {
+		t.Errorf("original entry was modified: %#v", e)
+	}
+}
+
+func TestVerboseKeys(t *testing.T) {
+	e := dictEntry{
+		SeqNo: 1049180,
+		REle:  []dictREle{{Reb: "コーヒー", ReNokanji: true, RePri: []string{"ichi1"}}},
+		Sense: []dictSense{{
+			Pos:     []string{"n"},
+			Lsource: []dictLsource{{Text: "koffie", Lang: "dut"}},
+			Gloss:   []dictGloss{{Text: "coffee"}},
+		}},
+	}
+
+	*verboseKeys = true
+	defer func() { *verboseKeys = false }()
+	actual, err := marshalVerbose(reflect.ValueOf(e))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"sequence":1049180,"readings":[{"text":"コーヒー","no_kanji":true,"priority":["ichi1"]}],` +
+		`"senses":[{"parts_of_speech":["n"],"loanword_sources":[{"text":"koffie","language":"dut"}],"glosses":[{"text":"coffee"}]}]}`
+	if string(actual) != expected {
+		t.Errorf("expected %s, got %s", expected, string(actual))
+	}
+
+	//every field needs a verbose key
+	var check func(reflect.Type)
+	check = func(t2 reflect.Type) {
+		switch t2.Kind() {
+		case reflect.Slice:
+			check(t2.Elem())
+		case reflect.Struct:
+			for idx := 0; idx < t2.NumField(); idx++ {
+				field := t2.Field(idx)
+				if field.Tag.Get("verbose") == "" {
+					t.Errorf("field %s.%s does not have a verbose key", t2.Name(), field.Name)
+				}
+				check(field.Type)
+			}
+		}
+	}
+	check(reflect.TypeOf(dictEntry{}))
+}
+
+func TestEntryWriter(t *testing.T) {
+	lines := []string{`{"n":1}` + "\n", "", `{"n":2}` + "\n"}
+	for _, count := range []int{0, 1, 3} {
+		var buf bytes.Buffer
+		w := entryWriter{Writer: &buf, AsArray: true}
+		must(w.Begin())
+		for _, line := range lines[:count] {
+			must(w.Write(line))
+		}
+		must(w.Finish())
+
+		var entries []map[string]int
+		err := json.Unmarshal(buf.Bytes(), &entries)
+		if err != nil {
+			t.Errorf("with %d lines: got invalid JSON array %q: %s", count, buf.String(), err.Error())
+		}
+		expectedLen := map[int]int{0: 0, 1: 1, 3: 2}[count]
+		if len(entries) != expectedLen {
+			t.Errorf("with %d lines: expected %d entries, got %q", count, expectedLen, buf.String())
+		}
+	}
+}
+
+func TestEntryWriterPretty(t *testing.T) {
+	lines := []string{`{"n":1,"R":[{"t":"あ"}]}` + "\n", "", `{"n":2}` + "\n"}
+	expected := map[bool]string{
+		false: "{\n\t\"n\": 1,\n\t\"R\": [\n\t\t{\n\t\t\t\"t\": \"あ\"\n\t\t}\n\t]\n}\n\n{\n\t\"n\": 2\n}\n",
+		true:  "[\n{\n\t\"n\": 1,\n\t\"R\": [\n\t\t{\n\t\t\t\"t\": \"あ\"\n\t\t}\n\t]\n},\n{\n\t\"n\": 2\n}\n]\n",
+	}
+	for _, asArray := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := entryWriter{Writer: &buf, AsArray: asArray, Pretty: true}
+		must(w.Begin())
+		for _, line := range lines {
+			must(w.Write(line))
+		}
+		must(w.Finish())
+		if buf.String() != expected[asArray] {
+			t.Errorf("with AsArray = %t: expected %q, got %q", asArray, expected[asArray], buf.String())
+		}
+	}
+}
+
+func TestEntryWriterGlossTSV(t *testing.T) {
+	entries := []dictEntry{
+		{
+			SeqNo: 1,
+			KEle:  []dictKEle{{Keb: "珈琲"}},
+			REle:  []dictREle{{Reb: "コーヒー"}},
+			Sense: []dictSense{
+				{Gloss: []dictGloss{{Text: "coffee"}, {Text: "Kaffee", Lang: "ger"}}},
+				{Gloss: []dictGloss{{Text: "a\tb\\c\nd"}}},
+			},
+		},
+		{
+			SeqNo: 2,
+			REle:  []dictREle{{Reb: "ああ"}},
+			Sense: []dictSense{{Gloss: []dictGloss{{Text: "ah!"}}}},
+		},
+	}
+	expected := "form\tlanguage\tgloss\n" +
+		"珈琲\teng\tcoffee\n" +
+		"珈琲\tger\tKaffee\n" +
+		"珈琲\teng\ta\\tb\\\\c\\nd\n" +
+		"ああ\teng\tah!\n"
+
+	var buf bytes.Buffer
+	w := entryWriter{Writer: &buf, GlossTSV: true}
+	must(w.Begin())
+	for _, e := range entries {
+		must(w.WriteGlossRows(e))
+	}
+	must(w.Finish())
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestStagedOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staged")
+	must(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entrypack.json")
+	must(ioutil.WriteFile(path, []byte("good\n"), 0666))
+
+	*inputSHA256 = "0000"
+	defer func() {
+		*inputSHA256 = ""
+		stagedOutputs = nil
+	}()
+
+	//a discarded output must not replace the existing file
+	must(ioutil.WriteFile(stagedPath(path), []byte("bad\n"), 0666))
+	discardStagedOutputs()
+	buf, err := ioutil.ReadFile(path)
+	must(err)
+	if string(buf) != "good\n" {
+		t.Errorf("expected existing output to be kept, got %q", string(buf))
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("expected temporary file to be removed")
+	}
+
+	//a committed output replaces the existing file
+	stagedOutputs = nil
+	must(ioutil.WriteFile(stagedPath(path), []byte("new\n"), 0666))
+	must(commitStagedOutputs())
+	buf, err = ioutil.ReadFile(path)
+	must(err)
+	if string(buf) != "new\n" {
+		t.Errorf("expected output to be replaced, got %q", string(buf))
+	}
+}
+
+func TestChecksumFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksum")
+	must(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entrypack.json")
+	contents := []byte(`{"v":1,"schema":[]}` + "\n")
+	must(ioutil.WriteFile(path, contents, 0666))
+
+	sum := sha256.Sum256(contents)
+	must(writeChecksumFile(path, sum[:]))
+	buf, err := ioutil.ReadFile(path + ".sha256")
+	must(err)
+	expected := hex.EncodeToString(sum[:]) + "  entrypack.json\n"
+	if string(buf) != expected {
+		t.Errorf("expected checksum file %q, got %q", expected, string(buf))
+	}
+	if err := checkChecksumFile(path + ".sha256"); err != nil {
+		t.Error(err.Error())
+	}
+
+	//a truncated file must be detected
+	must(ioutil.WriteFile(path, contents[:10], 0666))
+	if checkChecksumFile(path+".sha256") == nil {
+		t.Error("expected checksum mismatch to be detected")
+	}
+}
+
+func TestVerifyEntrypack(t *testing.T) {
+	input := `{"v":1,"schema":[]}
+{"n":1000100,"K":[{"t":"ＡＢＣ順"}],"R":[{"t":"エービーシーじゅん"}],"S":[{"G":[{"t":"alphabetical order"},{"t":"alphabetische Reihenfolge","l":"ger"}]}]}
+{"n":1000110,"R":[{"t":"エービーシー"}],"S":[]}
+{"n":1000110,"R":[{"t":"エービーシー"}],"S":[{"G":[{"t":"ABC"}]}]}
+{"n":1000090,"K":[{"t":"ＡＢＣ"}],"R":[],"S":[{"p":["n"]}]}
+{"n":1000120,"R":[{"t":"エービーシー"}],"S":null}
+not JSON
+`
+	report, err := verifyEntrypack(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	expected := `5 entries, thereof 2 with kanji elements and 2 without senses
+1 senses without glosses
+2 glosses in language "eng"
+1 glosses in language "ger"
+line 4: entry 1000110 appears more than once
+line 5: entry 1000090 does not have any reading elements
+line 5: entry 1000090 comes after entry 1000110
+line 6: entry 1000120 does not have a list of senses
+line 7: invalid character 'o' in literal null (expecting 'u')
+found 5 violations
+`
+	if buf.String() != expected {
+		t.Errorf("expected report %q, got %q", expected, buf.String())
+	}
+}
+
+func TestShardWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shards")
+	must(err)
+	defer os.RemoveAll(dir)
+
+	//each line is 14 bytes, so two lines fit into each shard (the header goes
+	//into the first shard)
+	w := shardWriter{Dir: dir, MaxBytes: 30}
+	must(w.WriteHeader(`{"v":1}` + "\n"))
+	for seqNo := uint64(1000010); seqNo <= 1000050; seqNo += 10 {
+		must(w.Write(seqNo, fmt.Sprintf(`{"n":%d}`+"\n", seqNo)))
+	}
+	must(w.Write(1000060, "")) //dropped entry
+	must(w.Finish())
+
+	var index struct {
+		Shards []shardInfo `json:"shards"`
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "entrypack.shards.json"))
+	must(err)
+	must(json.Unmarshal(buf, &index))
+	expected := []shardInfo{
+		{"entrypack.000.json", 1000010, 1000010, 22, 1},
+		{"entrypack.001.json", 1000020, 1000030, 28, 2},
+		{"entrypack.002.json", 1000040, 1000050, 28, 2},
+	}
+	if !reflect.DeepEqual(index.Shards, expected) {
+		t.Errorf("expected shards %#v, got %#v", expected, index.Shards)
+	}
+	for _, shard := range expected {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, shard.Path))
+		must(err)
+		if len(buf) != shard.Bytes {
+			t.Errorf("expected %s to have %d bytes, got %q", shard.Path, shard.Bytes, string(buf))
+		}
+	}
+
+	//entries that do not fit into any shard are rejected
+	if w.Write(1000070, strings.Repeat("x", 31)) == nil {
+		t.Error("expected oversized entry to be rejected")
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	registerTestEntities()
+	sets := make(map[string]map[string]string)
+	for _, setName := range []string{"ke_inf", "re_inf", "pos", "field", "misc", "dial"} {
+		sets[setName] = decoderEntities
+	}
+
+	for _, tc := range goldenEntries {
+		//parse -> emit -> parse must give identical results
+		expected, err := processEntry(tc.XML)
+		must(err)
+		var e dictEntry
+		must(json.Unmarshal([]byte(expected), &e))
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		must(writeEntryXML(w, e, sets))
+		must(w.Flush())
+		actual, err := processEntry(buf.String())
+		if err != nil {
+			t.Errorf("%s: cannot parse generated XML: %s\n%s", tc.Name, err.Error(), buf.String())
+			continue
+		}
+		if actual != expected {
+			t.Errorf("%s: round trip changed the entry\nexpected: %s\n  actual: %s", tc.Name, expected, actual)
+		}
+	}
+
+	//unknown entities are rejected, since they would make the output unparseable
+	e := dictEntry{SeqNo: 1000000, REle: []dictREle{{Reb: "あ"}}, Sense: []dictSense{{Pos: []string{"nonexistent"}}}}
+	if writeEntryXML(bufio.NewWriter(ioutil.Discard), e, sets) == nil {
+		t.Error("expected unknown entity to be rejected")
+	}
+
+	//the header must be recognized by processOpening()
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeXMLHeader(w, map[string]map[string]string{"pos": {"n": "noun (common) (futsuumeishi)"}})
+	must(w.Flush())
+	lines := strings.Split(buf.String(), "\n")
+	if !entityHeaderRx.MatchString(lines[2]) || !entityDefRx.MatchString(lines[3]) || lines[5] != "<JMdict>" {
+		t.Errorf("unexpected header: %q", buf.String())
+	}
+}
+
+func TestSchemaDetection(t *testing.T) {
+	dtd := []string{
+		`<!ELEMENT sense (stagk*, stagr*, pos*, xref*, ant*, field*, misc*, s_inf*, lsource*, dial*, gloss*, example*)>`,
+		`<!ELEMENT example (ex_srce,ex_text,ex_sent+)>`,
+		`<!ATTLIST lsource ls_wasei CDATA #IMPLIED>`,
+		`<!-- JMdict created: 2023-07-25 -->`,
+		`<!-- <ke_inf> (kanji info) entities -->`,
+		`<!ENTITY sK "search-only kanji form">`,
+		`<!-- <re_inf> (reading info) entities -->`,
+		`<!ENTITY sk "search-only kana form">`,
+		`<JMdict>`,
+	}
+	//processOpening() writes entities.json, so put it in a temporary directory
+	dir, err := ioutil.TempDir("", "schema")
+	must(err)
+	defer os.RemoveAll(dir)
+	entitiesPath := filepath.Join(dir, "entities.json")
+
+	for _, withExamples := range []bool{false, true} {
+		lines := dtd
+		expected := []string{"examples", "search-only-forms", "wasei"}
+		if !withExamples {
+			lines = dtd[2:]
+			expected = expected[1:]
+		}
+		idx := 0
+		header := processOpening(func() string {
+			idx++
+			return lines[idx-1]
+		}, entitiesPath)
+		if !reflect.DeepEqual(header, packHeader{Version: 1, Schema: expected, JMdictDate: "2023-07-25"}) {
+			t.Errorf("expected schema %v, got %#v", expected, header)
+		}
+	}
+	sets := readEntitySets(entitiesPath)
+	if sets["ke_inf"]["sK"] != "search-only kanji form" {
+		t.Errorf("unexpected contents of %s: %#v", entitiesPath, sets)
+	}
+
+	if !isPackHeader([]byte(`{"v":1,"schema":[]}`)) || isPackHeader([]byte(`{"n":1000000}`)) {
+		t.Error("isPackHeader() does not tell the header and the entries apart")
+	}
+}
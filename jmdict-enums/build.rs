@@ -6,16 +6,17 @@
 
 use json::JsonValue;
 
+#[derive(Clone)]
 struct EnumVariant {
-    code: &'static str,
-    name: &'static str,
+    code: String,
+    name: String,
     enabled: bool,
 }
 
-fn v(code: &'static str, name: &'static str) -> EnumVariant {
+fn v(code: &str, name: &str) -> EnumVariant {
     EnumVariant {
-        code,
-        name,
+        code: code.into(),
+        name: name.into(),
         enabled: true,
     }
 }
@@ -36,9 +37,21 @@ struct Enum<'a> {
 
 fn main() {
     println!("cargo:rerun-if-changed=build.rs");
-    println!("cargo:rerun-if-changed=data/entities.json");
-
-    let entities_str = std::fs::read_to_string("data/entities.json").unwrap();
+    println!("cargo:rerun-if-env-changed=RUST_JMDICT_ENTITIES");
+
+    //use override path if explicitly given, otherwise use the file bundled with this crate
+    let entities_path = match std::env::var_os("RUST_JMDICT_ENTITIES") {
+        Some(path) => std::path::PathBuf::from(path),
+        None => std::path::PathBuf::from("data/entities.json"),
+    };
+    println!("cargo:rerun-if-changed={}", entities_path.display());
+    println!(
+        "cargo:warning=using JMdict entities from {}",
+        entities_path.display()
+    );
+
+    let entities_str = std::fs::read_to_string(&entities_path)
+        .unwrap_or_else(|err| panic!("cannot read {}: {}", entities_path.display(), err));
     let entities = json::parse(&entities_str).unwrap();
 
     let mut content = String::new();
@@ -64,23 +77,29 @@ fn main() {
         ],
     }));
 
-    content.push_str(&process(Enum {
+    //the gloss languages are listed in a data file that the preprocessor reads as well
+    println!("cargo:rerun-if-changed=data/languages.json");
+    let languages_str = std::fs::read_to_string("data/languages.json")
+        .unwrap_or_else(|err| panic!("cannot read data/languages.json: {}", err));
+    let languages = json::parse(&languages_str).unwrap();
+
+    let gloss_language = Enum {
         name: "GlossLanguage",
         all_name: Some("AllGlossLanguage"),
         doc: "The language of a particular Gloss.".into(),
         entities: None,
-        variants: vec![
-            v("eng", "English").when(cfg!(feature = "translations-eng")),
-            v("dut", "Dutch").when(cfg!(feature = "translations-dut")),
-            v("fre", "French").when(cfg!(feature = "translations-fre")),
-            v("ger", "German").when(cfg!(feature = "translations-ger")),
-            v("hun", "Hungarian").when(cfg!(feature = "translations-hun")),
-            v("rus", "Russian").when(cfg!(feature = "translations-rus")),
-            v("slv", "Slovenian").when(cfg!(feature = "translations-slv")),
-            v("spa", "Spanish").when(cfg!(feature = "translations-spa")),
-            v("swe", "Swedish").when(cfg!(feature = "translations-swe")),
-        ],
-    }));
+        variants: languages
+            .members()
+            .map(|l| {
+                let code = l["code"].as_str().unwrap();
+                //Cargo exposes the feature "translations-xxx" as $CARGO_FEATURE_TRANSLATIONS_XXX
+                let feature_var = format!("CARGO_FEATURE_TRANSLATIONS_{}", code.to_uppercase());
+                v(code, l["name"].as_str().unwrap()).when(std::env::var_os(feature_var).is_some())
+            })
+            .collect(),
+    };
+    content.push_str(&process_iso_codes(&gloss_language, &languages));
+    content.push_str(&process(gloss_language));
 
     content.push_str(&process(Enum {
         name: "GlossType",
@@ -108,6 +127,7 @@ fn main() {
             v("io", "IrregularOkuriganaUsage"),
             v("oK", "OutdatedKanji"),
             v("rK", "RareKanjiForm"),
+            v("sK", "SearchOnlyKanjiForm"),
         ],
     }));
 
@@ -220,6 +240,7 @@ fn main() {
             v("gikun", "GikunOrJukujikun"),
             v("ik", "IrregularKanaUsage"),
             v("ok", "OutdatedKanaUsage"),
+            v("sk", "SearchOnlyKanaForm"),
             v("uK", "UsuallyWrittenUsingKanjiAlone"),
         ],
     }));
@@ -373,6 +394,84 @@ fn main() {
     std::fs::write(&dest_path, content).unwrap();
 }
 
+///Renders the ISO 639 conversions for GlossLanguage. The JMdict uses the ISO 639-2/B codes, so
+///those are the codes of the enum variants; the ISO 639-2/T and ISO 639-1 codes are taken from
+///data/languages.json, where "" means that a language does not have a two-letter code.
+fn process_iso_codes(e: &Enum, languages: &JsonValue) -> String {
+    let mut lines = vec![];
+
+    let names = std::iter::once((e.name, false)).chain(e.all_name.map(|n| (n, true)));
+    for (name, is_all) in names {
+        let variants: Vec<_> = e.variants.iter().filter(|v| is_all || v.enabled).collect();
+        let iso_codes = |v: &EnumVariant| {
+            let l = languages
+                .members()
+                .find(|l| l["code"].as_str() == Some(v.code.as_str()))
+                .unwrap();
+            let code = |key: &str| {
+                l[key].as_str().unwrap_or_else(|| {
+                    panic!(
+                        "missing {} for {}::{} in data/languages.json",
+                        key, e.name, v.name
+                    )
+                })
+            };
+            (code("iso_639_2t"), code("iso_639_1"))
+        };
+
+        lines.push(format!("impl {} {{", name));
+
+        //fn iso_639_2(&self) -> &str
+        lines.push("    ///Returns the ISO 639-2/B code for this language, e.g. `ger` for German. This is the same as `self.code()`.".into());
+        lines.push("    pub fn iso_639_2(&self) -> &'static str {".into());
+        lines.push("        self.code()".into());
+        lines.push("    }\n".into());
+
+        //fn iso_639_1(&self) -> Option<&str>
+        lines.push("    ///Returns the ISO 639-1 code for this language, e.g. `de` for German, or `None` if this language does not have a two-letter code.".into());
+        lines.push("    pub fn iso_639_1(&self) -> Option<&'static str> {".into());
+        lines.push("        match *self {".into());
+        for v in variants.iter() {
+            match iso_codes(v).1 {
+                "" => lines.push(format!("            {}::{} => None,", name, v.name)),
+                code => lines.push(format!(
+                    "            {}::{} => Some(\"{}\"),",
+                    name, v.name, code
+                )),
+            }
+        }
+        lines.push("        }".into());
+        lines.push("    }\n".into());
+
+        //fn from_iso(&str) -> Option<Self>
+        lines.push("    ///Parses an ISO 639-1, ISO 639-2/B or ISO 639-2/T code into a value of this enum. The input is matched case-insensitively.".into());
+        lines.push("    ///If the input is a BCP 47 language tag like `de-CH`, only its primary language subtag is considered.".into());
+        lines.push("    pub fn from_iso(code: &str) -> Option<Self> {".into());
+        lines.push("        let code = code.split(|c| c == '-' || c == '_').next().unwrap().to_ascii_lowercase();".into());
+        lines.push("        match code.as_str() {".into());
+        for v in variants.iter() {
+            let c = iso_codes(v);
+            let mut codes = vec![v.code.as_str(), c.0, c.1];
+            codes.retain(|code| !code.is_empty());
+            codes.dedup();
+            let pattern: Vec<_> = codes.iter().map(|c| format!("\"{}\"", c)).collect();
+            lines.push(format!(
+                "            {} => Some({}::{}),",
+                pattern.join(" | "),
+                name,
+                v.name
+            ));
+        }
+        lines.push("            _ => None,".into());
+        lines.push("        }".into());
+        lines.push("    }".into());
+
+        lines.push("}\n".into());
+    }
+
+    lines.join("\n")
+}
+
 fn process(e: Enum) -> String {
     let mut lines = vec![];
 
@@ -383,7 +482,7 @@ fn process(e: Enum) -> String {
             all_name: None,
             doc: format!("{} This enum contains all possible variants, including those that have been disabled by compile-time flags in `enum {}`.", e.doc, e.name),
             entities: e.entities,
-            variants: e.variants.iter().map(|v| EnumVariant{enabled: true, ..*v}).collect(),
+            variants: e.variants.iter().map(|v| EnumVariant{enabled: true, ..v.clone()}).collect(),
         }));
     }
 
@@ -394,7 +493,10 @@ fn process(e: Enum) -> String {
     lines.push(format!("pub enum {} {{", e.name));
     for v in e.variants.iter().filter(|v| v.enabled) {
         if let Some(ref entities) = e.entities {
-            lines.push(format!("  ///{}", entities[v.code].as_str().unwrap()));
+            lines.push(format!(
+                "  ///{}",
+                entities[v.code.as_str()].as_str().unwrap()
+            ));
         }
         lines.push(format!("  {},", v.name));
     }
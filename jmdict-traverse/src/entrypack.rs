@@ -5,7 +5,7 @@
 *******************************************************************************/
 
 use hex_literal::hex;
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 
 const ENTRYPACK_URL: &str = "https://dl.xyrillian.de/jmdict/entrypack-v1-2021-07-19.json.gz";
 const ENTRYPACK_SHA256SUM: [u8; 32] =
@@ -32,12 +32,18 @@ impl EntryPack {
             //default behavior: use file from repository for development builds, otherwise download
             //from hard-coded source
             None => {
-                let local_path = std::path::Path::new("data/entrypack.json");
+                let local_path = Path::new("data/entrypack.json");
+                let local_index_path = Path::new("data/entrypack.shards.json");
                 if local_path.exists() {
                     Self {
                         path: local_path.into(),
                         sha256sum: None,
                     }
+                } else if local_index_path.exists() {
+                    Self {
+                        path: local_index_path.into(),
+                        sha256sum: None,
+                    }
                 } else {
                     Self {
                         path: download_to_cache(ENTRYPACK_URL),
@@ -48,26 +54,62 @@ impl EntryPack {
         }
     }
 
+    ///Returns the entrypack contents, one entry per line. If the entrypack is split into shards,
+    ///the contents of all shards are concatenated.
     pub fn contents(&self) -> String {
-        use libflate::gzip::Decoder;
-        use sha2::{Digest, Sha256};
-        use std::io::Read;
-
-        let data = std::fs::read(&self.path).unwrap();
-        if let Some(expected_hash) = self.sha256sum {
-            let hash = Sha256::digest(&data[..]);
-            assert_eq!(&hash[..], expected_hash);
+        if !self.is_shard_index() {
+            return read_file(&self.path, self.sha256sum);
         }
+        let mut result = String::with_capacity(100 << 20);
+        for path in self.shard_paths() {
+            result.push_str(&read_file(&path, None));
+            if !result.ends_with('\n') {
+                result.push('\n');
+            }
+        }
+        result
+    }
 
-        //check for GZip magic number
-        if data[0] == 31 && data[1] == 139 {
-            let mut decoder = Decoder::new(&data[..]).unwrap();
-            let mut result = String::with_capacity(100 << 20);
-            decoder.read_to_string(&mut result).unwrap();
-            result
-        } else {
-            String::from_utf8(data).unwrap()
+    ///If the entrypack is split into shards (see `-shard-max-bytes` in data/README.md), returns
+    ///the paths of all shards in order. Otherwise, returns an empty list.
+    pub fn shard_paths(&self) -> Vec<PathBuf> {
+        if !self.is_shard_index() {
+            return Vec::new();
         }
+        let index = json::parse(&read_file(&self.path, self.sha256sum))
+            .unwrap_or_else(|err| panic!("cannot parse {}: {}", self.path.display(), err));
+        let dir = self.path.parent().unwrap_or_else(|| Path::new("."));
+        index["shards"]
+            .members()
+            .map(|shard| dir.join(shard["path"].as_str().unwrap()))
+            .collect()
+    }
+
+    fn is_shard_index(&self) -> bool {
+        self.path.to_string_lossy().ends_with(".shards.json")
+    }
+}
+
+fn read_file(path: &Path, sha256sum: Option<&[u8; 32]>) -> String {
+    use libflate::gzip::Decoder;
+    use sha2::{Digest, Sha256};
+    use std::io::Read;
+
+    let data =
+        std::fs::read(path).unwrap_or_else(|err| panic!("cannot read {}: {}", path.display(), err));
+    if let Some(expected_hash) = sha256sum {
+        let hash = Sha256::digest(&data[..]);
+        assert_eq!(&hash[..], expected_hash);
+    }
+
+    //check for GZip magic number
+    if data.len() >= 2 && data[0] == 31 && data[1] == 139 {
+        let mut decoder = Decoder::new(&data[..]).unwrap();
+        let mut result = String::with_capacity(100 << 20);
+        decoder.read_to_string(&mut result).unwrap();
+        result
+    } else {
+        String::from_utf8(data).unwrap()
     }
 }
 
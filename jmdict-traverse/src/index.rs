@@ -0,0 +1,119 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Construction of the inverted indexes that the `jmdict` crate embeds when the respective
+//! `index-XXX` features are enabled. This lives here instead of in `build.rs` so that the tests
+//! of the `jmdict` crate can rebuild the indexes and compare them with the embedded ones.
+
+use jmdict_enums::Priority;
+use std::collections::HashMap;
+use std::convert::TryInto;
+
+///Builder for an inverted index that maps u32 keys (e.g. kanji characters) to lists of entry
+///indexes.
+///
+///The encoded form only depends on the set of inserted items, not on the order of insertion or
+///on the iteration order of the internal HashMap. This is important for reproducible builds.
+#[derive(Default)]
+pub struct IndexBuilder {
+    //for each key, the entries as (rank, entry index)
+    lists: HashMap<u32, Vec<(u32, u32)>>,
+}
+
+impl IndexBuilder {
+    ///Adds an entry to the list for the given key. Within each list, entries are ordered by
+    ///ascending rank, then by entry index.
+    ///
+    ///When the same entry is inserted for the same key several times in a row, only the best
+    ///(i.e. lowest) rank is kept.
+    pub fn insert(&mut self, key: u32, rank: u32, entry_idx: u32) {
+        let list = self.lists.entry(key).or_default();
+        match list.last_mut() {
+            Some(last) if last.1 == entry_idx => last.0 = last.0.min(rank),
+            _ => list.push((rank, entry_idx)),
+        }
+    }
+
+    ///Encodes the index into two arrays: The first array contains triples of (key, start, end),
+    ///sorted by key. The second array contains the concatenated lists of entry indexes. For each
+    ///key, the entry indexes are in `values[start..end]`.
+    pub fn encode(&self) -> (Vec<u32>, Vec<u32>) {
+        let mut keys: Vec<u32> = self.lists.keys().copied().collect();
+        keys.sort_unstable();
+
+        let mut key_data = Vec::with_capacity(keys.len() * 3);
+        let mut value_data = Vec::new();
+        for key in keys {
+            let mut items = self.lists[&key].clone();
+            items.sort_unstable();
+            key_data.push(key);
+            key_data.push(value_data.len().try_into().unwrap());
+            value_data.extend(items.into_iter().map(|(_, entry_idx)| entry_idx));
+            key_data.push(value_data.len().try_into().unwrap());
+        }
+        (key_data, value_data)
+    }
+}
+
+///Whether this character is a kanji for the purposes of the kanji index. This covers the CJK
+///Unified Ideographs including all extensions, as well as the compatibility ideographs.
+pub fn is_kanji(c: char) -> bool {
+    matches!(
+        c,
+        '\u{3400}'..='\u{4DBF}'
+            | '\u{4E00}'..='\u{9FFF}'
+            | '\u{F900}'..='\u{FAFF}'
+            | '\u{20000}'..='\u{3FFFF}'
+    )
+}
+
+///Ranks vocabulary for the ordering of index entries: Common words come first, ordered by their
+///frequency bucket if they have one. Lower is better.
+pub fn priority_rank(p: Priority) -> u32 {
+    if !p.is_common() {
+        1000
+    } else if p.frequency_bucket > 0 {
+        p.frequency_bucket.into()
+    } else {
+        100
+    }
+}
+
+///Ranks vocabulary for `jmdict::entries_by_frequency()` with finer granularity than
+///[priority_rank()]. Lower is better.
+///
+///Common words come first. Within those, the frequency bucket from the wordfreq file decides,
+///and words without a bucket go after those with one. Ties are broken by the number of corpora
+///that list the word, where `Primary` counts double.
+pub fn frequency_score(p: Priority) -> u32 {
+    use jmdict_enums::PriorityInCorpus::*;
+    let bucket: u32 = if p.frequency_bucket > 0 {
+        p.frequency_bucket.into()
+    } else {
+        49
+    };
+    let markers: u32 = [p.news, p.ichimango, p.loanwords, p.additional]
+        .iter()
+        .map(|c| match c {
+            Primary => 2,
+            Secondary => 1,
+            Absent => 0,
+        })
+        .sum();
+    let uncommon = if p.is_common() { 0 } else { 1 };
+    (uncommon * 50 + bucket) * 16 + (8 - markers)
+}
+
+///Sorts entries for the frequency index. Each item is a triple of (score, sequence number, entry
+///index), where the score is the best [frequency_score()] of all kanji and reading elements of
+///the entry. Returns the entry indexes ordered by ascending score, then by sequence number.
+pub fn sort_by_frequency(mut items: Vec<(u32, u32, u32)>) -> Vec<u32> {
+    items.sort_unstable();
+    items
+        .into_iter()
+        .map(|(_, _, entry_idx)| entry_idx)
+        .collect()
+}
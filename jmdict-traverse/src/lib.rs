@@ -21,9 +21,12 @@ use jmdict_enums::{
 };
 use json::JsonValue;
 use std::convert::TryInto;
+use std::io::BufRead;
+use std::ops::ControlFlow;
 
 mod entrypack;
 use entrypack::EntryPack;
+pub mod index;
 
 pub struct RawEntry<'a> {
     pub ent_seq: u32,
@@ -49,6 +52,8 @@ pub struct RawReadingElement<'a> {
 pub struct RawSense<'a> {
     pub stagk: Vec<&'a str>,
     pub stagr: Vec<&'a str>,
+    ///This already includes parts of speech that are inherited from previous senses (see
+    ///`collect_senses()`).
     pub pos: Vec<PartOfSpeech>,
     pub xref: Vec<&'a str>,
     pub ant: Vec<&'a str>,
@@ -84,6 +89,47 @@ pub trait Visitor {
     ///This is called once for each file that was read from disk. The build script uses this to
     ///generate `cargo:rerun-if-changed` directives.
     fn notify_data_file_path(&mut self, _path: &str) {}
+
+    ///This is called for each malformed entry that is skipped because of [ErrorPolicy::Skip].
+    fn notify_skipped_entry(&mut self, _err: &LoadError) {}
+
+    ///This is called before the first entry if the entrypack starts with a header. Entrypacks
+    ///generated by older versions of the preprocessor do not have a header.
+    fn notify_header(&mut self, _header: &PackHeader) {}
+}
+
+///Metadata from the first line of the entrypack, as written by `data/preprocess-jmdict.go`.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+pub struct PackHeader {
+    pub version: u32,
+    ///Optional parts of the JMdict schema that were present in the DTD of the JMdict file that
+    ///the entrypack was generated from, e.g. `"search-only-forms"` or `"examples"`.
+    pub schema_features: Vec<String>,
+    ///The creation date of the JMdict file that the entrypack was generated from, in the format
+    ///`YYYY-MM-DD`. This is `None` if the JMdict file did not state its creation date.
+    pub jmdict_date: Option<String>,
+}
+
+impl PackHeader {
+    pub fn has_schema_feature(&self, feature: &str) -> bool {
+        self.schema_features.iter().any(|f| f == feature)
+    }
+
+    //The header can be told apart from the entries because it does not have the "n" key.
+    fn from_obj(obj: &JsonValue) -> Option<Self> {
+        if !obj.has_key("v") || obj.has_key("n") {
+            return None;
+        }
+        Some(Self {
+            version: obj["v"].as_u32().unwrap_or(0),
+            schema_features: obj["schema"]
+                .members()
+                .filter_map(|f| f.as_str())
+                .map(String::from)
+                .collect(),
+            jmdict_date: obj["jmdict_date"].as_str().map(String::from),
+        })
+    }
 }
 
 ///Options for traversing a JMdict file. This controls which entries the [Visitor] visits, and
@@ -92,25 +138,175 @@ pub struct Options {
     pub is_db_minimal: bool,
     pub with_uncommon: bool,
     pub with_archaic: bool,
+    pub on_error: ErrorPolicy,
+}
+
+///What [process_dictionary()] and [stream_entries()] do when they encounter a malformed entry.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum ErrorPolicy {
+    ///Abort and return the [LoadError].
+    Fail,
+    ///Report the [LoadError] to [Visitor::notify_skipped_entry()] (or the `on_skipped` callback of
+    ///[stream_entries()]) and continue with the next entry. This only covers the cases described
+    ///by [LoadError]. Other inconsistencies, like unknown enum values, still cause a panic.
+    Skip,
 }
 
+impl Default for ErrorPolicy {
+    fn default() -> Self {
+        Self::Fail
+    }
+}
+
+///Error type for [process_dictionary()] and [stream_entries()]. This is returned when the entrypack contains malformed
+///entries.
+#[derive(Debug)]
+pub enum LoadError {
+    ///The entry on the given line (counting from 1) is not valid JSON.
+    InvalidJson { line: usize, error: json::Error },
+    ///The entry with the given sequence number does not have any reading elements. The JMdict DTD
+    ///requires at least one reading element per entry, and the `jmdict` crate relies on that.
+    NoReadingElements { ent_seq: u32 },
+    ///The entrypack could not be read. This is only returned by [stream_entries()], and is not
+    ///affected by [ErrorPolicy::Skip].
+    Io(std::io::Error),
+}
+
+impl std::fmt::Display for LoadError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            LoadError::InvalidJson { line, error } => {
+                write!(f, "entry on line {} is not valid JSON: {}", line, error)
+            }
+            LoadError::NoReadingElements { ent_seq } => {
+                write!(f, "entry {} does not have any reading elements", ent_seq)
+            }
+            LoadError::Io(error) => write!(f, "cannot read entrypack: {}", error),
+        }
+    }
+}
+
+impl std::error::Error for LoadError {}
+
 ///Entry point for this file. All other functions are called directly or indirectly from this fn.
-pub fn process_dictionary<V: Visitor>(v: &mut V, opts: Options) {
+pub fn process_dictionary<V: Visitor>(v: &mut V, opts: Options) -> Result<(), LoadError> {
     let entrypack = EntryPack::locate_or_download();
     v.notify_data_file_path(&entrypack.path.to_string_lossy());
+    for path in entrypack.shard_paths() {
+        v.notify_data_file_path(&path.to_string_lossy());
+    }
+
+    let contents = entrypack.contents();
+    process_lines(contents.as_bytes(), &opts, |event| {
+        match event {
+            Event::Header(header) => v.notify_header(&header),
+            Event::Entry(entry) => v.process_entry(entry),
+            Event::Skipped(err) => v.notify_skipped_entry(&err),
+        }
+        ControlFlow::Continue(())
+    })
+}
+
+///Reads an entrypack from `reader` and calls `f` for each entry, one line at a time. Unlike
+///[process_dictionary()], this never holds more than one entry in memory, so it can be used for
+///batch jobs on entrypacks that do not fit into memory. The entrypack must not be compressed;
+///wrap the reader in a decompressor if necessary.
+///
+///Entries are filtered according to `opts`. Malformed entries are handled according to
+///`opts.on_error`; with [ErrorPolicy::Skip], they are reported to `on_skipped` (like
+///[Visitor::notify_skipped_entry()]) and then skipped. Return `ControlFlow::Break(())` from `f` to
+///stop reading early.
+pub fn stream_entries<R, F, S>(
+    reader: R,
+    opts: &Options,
+    mut f: F,
+    mut on_skipped: S,
+) -> Result<(), LoadError>
+where
+    R: BufRead,
+    F: FnMut(&RawEntry) -> ControlFlow<()>,
+    S: FnMut(&LoadError),
+{
+    process_lines(reader, opts, |event| match event {
+        Event::Entry(entry) => f(entry),
+        Event::Skipped(err) => {
+            on_skipped(&err);
+            ControlFlow::Continue(())
+        }
+        Event::Header(_) => ControlFlow::Continue(()),
+    })
+}
 
-    for entry_str in entrypack.contents().split('\n') {
-        if !entry_str.is_empty() {
-            let entry_obj = json::parse(entry_str).unwrap();
-            if let Some(entry_raw) = RawEntry::from_obj(&entry_obj, &opts) {
-                if opts.is_db_minimal && entry_raw.ent_seq >= 1010000 {
-                    //for db-minimal, only process entries from data/entries-100.json
-                    return;
+enum Event<'a, 'b> {
+    Header(PackHeader),
+    Entry(&'b RawEntry<'a>),
+    //an entry that is skipped because of ErrorPolicy::Skip
+    Skipped(LoadError),
+}
+
+//Shared implementation of process_dictionary() and stream_entries().
+fn process_lines<R, F>(mut reader: R, opts: &Options, mut f: F) -> Result<(), LoadError>
+where
+    R: BufRead,
+    F: FnMut(Event) -> ControlFlow<()>,
+{
+    //the line buffer is reused for all entries
+    let mut line = String::new();
+    for idx in 0.. {
+        line.clear();
+        if reader.read_line(&mut line).map_err(LoadError::Io)? == 0 {
+            break;
+        }
+        let entry_str = line.trim_end_matches('\n');
+        if entry_str.is_empty() {
+            continue;
+        }
+
+        if idx == 0 && entry_str.starts_with(r#"{"v":"#) {
+            let header = json::parse(entry_str)
+                .ok()
+                .and_then(|obj| PackHeader::from_obj(&obj));
+            if let Some(header) = header {
+                if f(Event::Header(header)).is_break() {
+                    break;
                 }
-                v.process_entry(&entry_raw);
+                continue;
+            }
+        }
+
+        let entry_obj = match parse_entry(idx + 1, entry_str) {
+            Ok(obj) => obj,
+            Err(err) => match opts.on_error {
+                ErrorPolicy::Fail => return Err(err),
+                ErrorPolicy::Skip => {
+                    if f(Event::Skipped(err)).is_break() {
+                        break;
+                    }
+                    continue;
+                }
+            },
+        };
+        if let Some(entry_raw) = RawEntry::from_obj(&entry_obj, opts) {
+            if opts.is_db_minimal && entry_raw.ent_seq >= 1010000 {
+                //for db-minimal, only process entries from data/entries-100.json
+                break;
+            }
+            if f(Event::Entry(&entry_raw)).is_break() {
+                break;
             }
         }
     }
+    Ok(())
+}
+
+fn parse_entry(line: usize, entry_str: &str) -> Result<JsonValue, LoadError> {
+    let entry_obj =
+        json::parse(entry_str).map_err(|error| LoadError::InvalidJson { line, error })?;
+    if entry_obj["R"].is_empty() {
+        let ent_seq = entry_obj["n"].as_u32().unwrap_or(0);
+        return Err(LoadError::NoReadingElements { ent_seq });
+    }
+    Ok(entry_obj)
 }
 
 trait Object<'a>: Sized {
@@ -140,11 +336,42 @@ impl<'a> Object<'a> for RawEntry<'a> {
             ent_seq: obj["n"].as_u32().unwrap(),
             k_ele: RawKanjiElement::collect(&obj["K"], opts),
             r_ele: RawReadingElement::collect_or_none(&obj["R"], opts)?,
-            sense: RawSense::collect_or_none(&obj["S"], opts)?,
+            sense: collect_senses(&obj["S"], opts)?,
         })
     }
 }
 
+//Like `RawSense::collect_or_none()`, but fills in inherited parts of speech. The JMdict DTD says
+//that the parts of speech of a sense apply to the following senses until a new part of speech is
+//given. This is applied separately for each gloss language, since the senses in other languages
+//are maintained separately from the English senses and do not follow their order. Inheritance
+//is computed before senses are filtered out, and is decided on the parts of speech in the
+//entrypack rather than on those that are enabled at compile time, so that it does not depend on
+//the compile-time configuration.
+fn collect_senses<'a>(array: &'a JsonValue, opts: &'_ Options) -> Option<Vec<RawSense<'a>>> {
+    let mut inherited: Vec<(&'a str, Vec<PartOfSpeech>)> = Vec::new();
+    let mut result = Vec::new();
+    for obj in array.members() {
+        let lang = obj["G"][0]["l"].as_str().unwrap_or("eng");
+        let mut pos: Vec<PartOfSpeech> = Object::collect(&obj["p"], opts);
+        match inherited.iter_mut().find(|(l, _)| *l == lang) {
+            Some((_, prev)) if obj["p"].is_empty() => pos = prev.clone(),
+            Some((_, prev)) => *prev = pos.clone(),
+            None => inherited.push((lang, pos.clone())),
+        }
+
+        if let Some(mut sense) = RawSense::from_obj(obj, opts) {
+            sense.pos = pos;
+            result.push(sense);
+        }
+    }
+    if result.is_empty() {
+        None
+    } else {
+        Some(result)
+    }
+}
+
 impl<'a> Object<'a> for RawKanjiElement<'a> {
     fn from_obj(obj: &'a JsonValue, opts: &'_ Options) -> Option<Self> {
         if !opts.with_uncommon && obj["p"].is_empty() {
@@ -312,6 +539,9 @@ impl<'a> Object<'a> for Dialect {
 
 impl<'a> Object<'a> for GlossLanguage {
     fn from_obj(obj: &'a JsonValue, _opts: &'_ Options) -> Option<Self> {
+        //A missing "l" key means English (the default value of xml:lang in the JMdict DTD), so
+        //that glosses with and without an explicit lang="eng" are treated the same. Unknown
+        //languages fail the build, so that glosses are not lost without anyone noticing.
         let lang: AllGlossLanguage = optional_enum(obj, "eng", "AllGlossLanguage");
         lang.try_into().ok()
     }
@@ -0,0 +1,69 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Analysis helpers for reviewing the contents of the JMdict.
+
+use crate::*;
+use std::collections::{BTreeSet, HashMap};
+
+///Finds pairs of distinct entries that share a reading and have kanji elements that only differ in
+///their kana, e.g. 画 and 画く (both read かく). Such entries may be candidates for merging. This is
+///intended for auditing the dataset, so it does not make any attempt at deciding whether the
+///entries are actually the same word.
+///
+///Readings are compared regardless of whether they are written in hiragana or katakana. In each
+///pair, the entry with the lower sequence number comes first. Pairs are ordered by sequence
+///numbers.
+pub fn find_okurigana_variants() -> Vec<(Entry, Entry)> {
+    let mut by_reading: HashMap<String, Vec<Entry>> = HashMap::new();
+    for entry in entries().filter(|e| e.kanji_elements().len() > 0) {
+        for reading in entry.reading_elements() {
+            let key: String = reading.text.chars().map(kana::to_hiragana).collect();
+            let candidates = by_reading.entry(key).or_default();
+            if candidates.last().map(|e| e.number) != Some(entry.number) {
+                candidates.push(entry);
+            }
+        }
+    }
+
+    let mut pairs = BTreeSet::new();
+    for candidates in by_reading.values() {
+        for (idx, a) in candidates.iter().enumerate() {
+            for b in &candidates[(idx + 1)..] {
+                if differ_only_in_kana(a, b) {
+                    pairs.insert(if a.number < b.number {
+                        (a.number, b.number)
+                    } else {
+                        (b.number, a.number)
+                    });
+                }
+            }
+        }
+    }
+
+    let by_number: HashMap<u32, Entry> = entries().map(|e| (e.number, e)).collect();
+    pairs
+        .into_iter()
+        .map(|(a, b)| (by_number[&a], by_number[&b]))
+        .collect()
+}
+
+fn differ_only_in_kana(a: &Entry, b: &Entry) -> bool {
+    a.kanji_elements().any(|ka| {
+        let skeleton = kanji_skeleton(ka.text);
+        !skeleton.is_empty()
+            && b.kanji_elements()
+                .any(|kb| ka.text != kb.text && skeleton == kanji_skeleton(kb.text))
+    })
+}
+
+///Removes all kana from the given text. As in [Entry::reading_with_okurigana()], ヵ and ヶ are not
+///counted as kana.
+fn kanji_skeleton(text: &str) -> String {
+    text.chars()
+        .filter(|&c| !kana::is_kana(c) || c == 'ヵ' || c == 'ヶ')
+        .collect()
+}
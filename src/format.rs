@@ -0,0 +1,290 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Helper methods for rendering database contents into human-readable text.
+
+use crate::*;
+
+impl Entry {
+    ///Returns the kanji element that should be displayed as the headword of this entry: the first
+    ///kanji element that is not [search-only](KanjiElement::is_search_only). Returns `None` for
+    ///entries without displayable kanji elements.
+    pub fn primary_kanji(&self) -> Option<KanjiElement> {
+        self.kanji_elements().find(|k| !k.is_search_only())
+    }
+
+    ///Returns the reading element that should be displayed for this entry: the first reading
+    ///element that is not [search-only](ReadingElement::is_search_only). If all reading elements
+    ///are search-only, the first one is returned.
+    pub fn primary_reading(&self) -> ReadingElement {
+        self.reading_elements()
+            .find(|r| !r.is_search_only())
+            .unwrap_or_else(|| self.reading_elements().next().unwrap())
+    }
+
+    ///Returns the text that should be displayed as the headword of this entry. This is the text of
+    ///[Entry::primary_kanji()] if there is one, or of [Entry::primary_reading()] otherwise.
+    pub fn display_headword(&self) -> &'static str {
+        match self.primary_kanji() {
+            Some(k) => k.text,
+            None => self.primary_reading().text,
+        }
+    }
+
+    ///Whether the reading should be displayed next to [Entry::display_headword()]. This is false
+    ///for entries without kanji elements, where the headword is the reading itself, and for the
+    ///rare entries whose primary kanji element is written entirely in kana and identical to the
+    ///primary reading. Displays like "ねこ【ねこ】" can be avoided by checking this first.
+    pub fn reading_differs_from_headword(&self) -> bool {
+        self.display_headword() != self.primary_reading().text
+    }
+
+    ///Returns the canonical dictionary form of this entry, i.e. the string that one would look up
+    ///in a paper dictionary. This is a natural key for joining e.g. the output of a deinflector
+    ///back to the entries.
+    ///
+    ///This is usually the same as [Entry::display_headword()], with one exception: If the first
+    ///sense of the entry is marked as
+    ///[usually written in kana](SenseInfo::UsuallyWrittenUsingKanaAlone), the text of
+    ///[Entry::primary_reading()] is returned even if there are kanji elements. For example, the
+    ///lemma of 為る is する. Only the first sense is considered since it reflects the main usage
+    ///of the word.
+    pub fn lemma(&self) -> &'static str {
+        let usually_kana = self.senses().next().map_or(false, |s| {
+            s.infos()
+                .any(|i| i == SenseInfo::UsuallyWrittenUsingKanaAlone)
+        });
+        if usually_kana {
+            self.primary_reading().text
+        } else {
+            self.display_headword()
+        }
+    }
+}
+
+impl Entry {
+    ///Renders this entry as a block of Markdown, e.g. for generating study notes. The output
+    ///starts with the headword in bold followed by the primary reading and, if the headword
+    ///contains kanji, a line with furigana as HTML `<ruby>` tags. Then follows a numbered list of
+    ///the senses that have glosses in the given language, with parts of speech in italics. For
+    ///example:
+    ///
+    ///```markdown
+    ///**お母さん** 【おかあさん】
+    ///
+    ///お<ruby>母<rt>かあ</rt></ruby>さん
+    ///
+    ///1. *n* mother; mom; mum; ma
+    ///```
+    ///
+    ///For entries without kanji elements (or, more generally, when
+    ///[Entry::reading_differs_from_headword()] is false), only the headword is shown. Senses that
+    ///are restricted to certain kanji or reading elements are annotated with e.g. "(only for
+    ///あそこ, あすこ)", and loanwords are annotated with their sources as rendered by
+    ///[LoanwordSource::describe()], e.g. "(from German: Arbeit)".
+    pub fn to_markdown(&self, lang: GlossLanguage) -> String {
+        self.to_markdown_truncated(lang, usize::MAX)
+    }
+
+    ///Like [Entry::to_markdown()], but renders at most `max_senses` senses. Only senses with
+    ///glosses in the given language count towards the limit. If senses were left out, a line like
+    ///`*+7 more*` is appended after the list.
+    pub fn to_markdown_truncated(&self, lang: GlossLanguage, max_senses: usize) -> String {
+        let mut out = String::new();
+        match self.primary_kanji() {
+            Some(kanji) if self.reading_differs_from_headword() => {
+                out.push_str(&format!(
+                    "**{}** 【{}】\n\n",
+                    kanji.text,
+                    self.primary_reading().text
+                ));
+                for span in self.reading_with_okurigana() {
+                    match span {
+                        ReadingSpan::Kanji { text, reading } => {
+                            out.push_str(&format!("<ruby>{}<rt>{}</rt></ruby>", text, reading))
+                        }
+                        ReadingSpan::Kana { text } => out.push_str(text),
+                    }
+                }
+                out.push('\n');
+            }
+            _ => out.push_str(&format!("**{}**\n", self.display_headword())),
+        }
+
+        let senses: Vec<_> = self.senses().filter(|s| s.has_language(lang)).collect();
+        if !senses.is_empty() {
+            out.push('\n');
+        }
+        let omitted_count = senses.len().saturating_sub(max_senses);
+        for (idx, sense) in senses.into_iter().take(max_senses).enumerate() {
+            out.push_str(&format!("{}. ", idx + 1));
+            let pos: Vec<_> = sense.parts_of_speech().map(|p| p.code()).collect();
+            if !pos.is_empty() {
+                out.push_str(&format!("*{}* ", pos.join(", ")));
+            }
+            let glosses: Vec<_> = sense
+                .glosses()
+                .filter(|g| g.language == lang)
+                .map(|g| escape_markdown(g.text))
+                .collect();
+            out.push_str(&glosses.join("; "));
+            let restrictions: Vec<_> = sense
+                .applicable_kanji_elements()
+                .chain(sense.applicable_reading_elements())
+                .collect();
+            if !restrictions.is_empty() {
+                out.push_str(&format!(" (only for {})", restrictions.join(", ")));
+            }
+            let sources: Vec<_> = sense
+                .loanword_sources()
+                .map(|l| escape_markdown(&l.describe()))
+                .collect();
+            if !sources.is_empty() {
+                out.push_str(&format!(" ({})", sources.join("; ")));
+            }
+            out.push('\n');
+        }
+        if omitted_count > 0 {
+            out.push_str(&format!("\n*+{} more*\n", omitted_count));
+        }
+        out
+    }
+}
+
+///Escapes characters that have a special meaning in inline Markdown.
+fn escape_markdown(text: &str) -> String {
+    let mut result = String::with_capacity(text.len());
+    for c in text.chars() {
+        if matches!(c, '\\' | '*' | '_' | '`' | '[' | ']' | '<' | '>') {
+            result.push('\\');
+        }
+        result.push(c);
+    }
+    result
+}
+
+impl Sense {
+    ///Like [Sense::glosses()], but with duplicates removed as described in [dedup_glosses()]. This
+    ///is intended for clean exports. The JMdict occasionally lists the same gloss twice in one
+    ///sense, but [Sense::glosses()] keeps those to stay faithful to the source data.
+    pub fn glosses_deduped(&self) -> Vec<Gloss> {
+        dedup_glosses(self.glosses())
+    }
+
+    ///Renders the glosses of this sense in the given languages into a single line, e.g.
+    ///`EN: mom; mother  DE: Mama; Mutter`. Languages are labeled with their ISO 639-1 code (or
+    ///their ISO 639-2 code if there is no ISO 639-1 code) and appear in the order given in `langs`.
+    ///Languages without any glosses in this sense are skipped.
+    pub fn format_glosses_multi(&self, langs: &[GlossLanguage]) -> String {
+        let mut parts = Vec::new();
+        for &lang in langs {
+            let glosses: Vec<_> = self.glosses_multi(&[lang]).iter().map(|g| g.text).collect();
+            if !glosses.is_empty() {
+                let label = lang.iso_639_1().unwrap_or_else(|| lang.iso_639_2());
+                parts.push(format!("{}: {}", label.to_uppercase(), glosses.join("; ")));
+            }
+        }
+        parts.join("  ")
+    }
+}
+
+impl LoanwordSource {
+    ///Renders a short description of this loanword source, e.g. `from German: Arbeit`. Partial
+    ///sources and wasei-eigo are marked as such, e.g. `from Russian (partial): kombinat` for
+    ///コンビナートキャンペーン or `from English (partial, wasei): price` for プチプライス. If the
+    ///source word is not given in the JMdict, only the language is shown, e.g. `from English`.
+    ///
+    ///```
+    ///let source = jmdict::LoanwordSource {
+    ///    text: "kombinat",
+    ///    language: "rus",
+    ///    is_partial: true,
+    ///    is_wasei: false,
+    ///};
+    ///assert_eq!(source.describe(), "from Russian (partial): kombinat");
+    ///```
+    pub fn describe(&self) -> String {
+        let mut out = format!("from {}", self.language_name());
+        match (self.is_partial, self.is_wasei) {
+            (true, true) => out.push_str(" (partial, wasei)"),
+            (true, false) => out.push_str(" (partial)"),
+            (false, true) => out.push_str(" (wasei)"),
+            (false, false) => {}
+        }
+        if !self.text.is_empty() {
+            out.push_str(": ");
+            out.push_str(self.text);
+        }
+        out
+    }
+
+    ///Returns the English name of the source language, e.g. "German" for `ger`. Only the languages
+    ///that occur frequently in the JMdict are known. For other languages, the ISO 639-2/B code is
+    ///returned as-is.
+    pub fn language_name(&self) -> &'static str {
+        match self.language {
+            "afr" => "Afrikaans",
+            "ain" => "Ainu",
+            "ara" => "Arabic",
+            "chi" => "Chinese",
+            "dan" => "Danish",
+            "dut" => "Dutch",
+            "eng" => "English",
+            "fin" => "Finnish",
+            "fre" => "French",
+            "ger" => "German",
+            "grc" => "Ancient Greek",
+            "gre" => "Greek",
+            "haw" => "Hawaiian",
+            "heb" => "Hebrew",
+            "hin" => "Hindi",
+            "hun" => "Hungarian",
+            "ind" => "Indonesian",
+            "ita" => "Italian",
+            "kor" => "Korean",
+            "lat" => "Latin",
+            "may" => "Malay",
+            "mon" => "Mongolian",
+            "nor" => "Norwegian",
+            "per" => "Persian",
+            "pol" => "Polish",
+            "por" => "Portuguese",
+            "rus" => "Russian",
+            "san" => "Sanskrit",
+            "spa" => "Spanish",
+            "swe" => "Swedish",
+            "tha" => "Thai",
+            "tur" => "Turkish",
+            "vie" => "Vietnamese",
+            other => other,
+        }
+    }
+}
+
+///Removes glosses that have the same text, language and type as an earlier gloss. The remaining
+///glosses stay in the order of their first occurrence.
+///
+///```
+///# use jmdict::*;
+///# #[cfg(feature = "translations-eng")] {
+///let gloss = |text| Gloss {
+///    language: GlossLanguage::English,
+///    text,
+///    gloss_type: GlossType::RegularTranslation,
+///};
+///let deduped = dedup_glosses(vec![gloss("mother"), gloss("mom"), gloss("mother")]);
+///assert_eq!(deduped, vec![gloss("mother"), gloss("mom")]);
+///# }
+///```
+pub fn dedup_glosses<I: IntoIterator<Item = Gloss>>(glosses: I) -> Vec<Gloss> {
+    let mut result: Vec<Gloss> = Vec::new();
+    for gloss in glosses {
+        if !result.contains(&gloss) {
+            result.push(gloss);
+        }
+    }
+    result
+}
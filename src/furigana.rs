@@ -0,0 +1,251 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Alignment of kanji elements with their readings, for displaying furigana and okurigana.
+
+use crate::homophones::priority_rank;
+use crate::*;
+use std::collections::{HashMap, HashSet};
+
+///A piece of a headword, as returned by [Entry::reading_with_okurigana()] and
+///[KanjiElement::reading_spans()].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum ReadingSpan {
+    ///A run of kanji (or other non-kana characters), together with the part of the reading that
+    ///it covers. For 持ち運ぶ, the kanji spans are 持 (read もち) and 運 (read はこ).
+    Kanji {
+        text: &'static str,
+        reading: &'static str,
+    },
+    ///A run of kana that is written out in the headword. This includes okurigana after a kanji
+    ///span as well as kana between kanji spans, e.g. the ち and ぶ in 持ち運ぶ. For entries
+    ///without kanji elements, the entire headword is a single kana span.
+    Kana { text: &'static str },
+}
+
+impl Entry {
+    ///Splits the [primary kanji element](Entry::primary_kanji) of this entry into runs of kanji
+    ///and runs of kana, and aligns the [primary reading element](Entry::primary_reading) with it. For 持ち運ぶ (もちはこぶ), this yields
+    ///`[Kanji("持", "も"), Kana("ち"), Kanji("運", "はこ"), Kana("ぶ")]`. This is the information
+    ///needed for displaying furigana: Only the [ReadingSpan::Kanji] spans need to be annotated.
+    ///
+    ///For entries without kanji elements, a single [ReadingSpan::Kana] containing the primary
+    ///reading element is returned. If the kana in the kanji element do not match the reading, the
+    ///entire kanji element is returned as a single [ReadingSpan::Kanji].
+    ///
+    ///Alignment happens at the level of kanji runs, not individual kanji: For 唐揚げ, the span
+    ///唐揚 is read からあ, since the reading of each kanji cannot be determined from the JMdict.
+    pub fn reading_with_okurigana(&self) -> Vec<ReadingSpan> {
+        let reading = self.primary_reading();
+        match self.primary_kanji() {
+            Some(kanji) => kanji.reading_spans(&reading).unwrap_or_else(|| {
+                vec![ReadingSpan::Kanji {
+                    text: kanji.text,
+                    reading: reading.text,
+                }]
+            }),
+            None => vec![ReadingSpan::Kana { text: reading.text }],
+        }
+    }
+}
+
+impl KanjiElement {
+    ///Aligns the given reading with this kanji element, as described for
+    ///[Entry::reading_with_okurigana()]. Returns `None` if the kana in this kanji element do not
+    ///match the reading.
+    pub fn reading_spans(&self, reading: &ReadingElement) -> Option<Vec<ReadingSpan>> {
+        align(self.text, reading.text)
+    }
+}
+
+///Looks up each of the given words, and returns the matching entries together with the furigana
+///for the word, e.g. for rendering subtitles. Words are matched against the texts of all kanji and
+///reading elements. If several entries match a word, the one where the matching element has the
+///best priority is used (common words first, then by frequency bucket, then by sequence number).
+///
+///For words that match a kanji element, the furigana are computed with
+///[KanjiElement::reading_spans()] using the first reading that applies to this kanji element. For
+///words that match a reading element, a single [ReadingSpan::Kana] is returned.
+///
+///Words that do not match any entry are skipped, and can be retrieved with
+///[FuriganaResults::unresolved()] afterwards:
+///
+///```
+///let mut results = jmdict::furigana_for(&["お母さん", "ではない言葉"]);
+///let (entry, spans) = results.next().unwrap();
+///assert_eq!(entry.number, 1002650);
+///assert_eq!(spans.len(), 3);
+///assert!(results.next().is_none());
+///assert_eq!(results.unresolved(), &["ではない言葉".to_string()]);
+///```
+///
+///All words are resolved in a single scan over all entries when this function is called.
+pub fn furigana_for(words: &[&str]) -> FuriganaResults {
+    let wanted: HashSet<&str> = words.iter().copied().collect();
+    //for each word: the priority rank and sequence number of the best match so far, and the match
+    let mut best: HashMap<&str, (u32, u32, Entry, Vec<ReadingSpan>)> = HashMap::new();
+    let mut consider = |word, rank, entry: Entry, spans: Option<Vec<ReadingSpan>>| {
+        let key = (rank, entry.number);
+        if best.get(word).map_or(true, |(r, n, _, _)| key < (*r, *n)) {
+            if let Some(spans) = spans {
+                best.insert(word, (rank, entry.number, entry, spans));
+            }
+        }
+    };
+
+    for entry in entries() {
+        for kanji in entry.kanji_elements() {
+            if let Some(&word) = wanted.get(kanji.text) {
+                let reading = entry
+                    .reading_elements()
+                    .filter(|r| !r.is_search_only())
+                    .find(|r| {
+                        r.applicable_kanji(&entry)
+                            .iter()
+                            .any(|k| k.text == kanji.text)
+                    });
+                let spans = reading.map(|r| {
+                    kanji.reading_spans(&r).unwrap_or_else(|| {
+                        vec![ReadingSpan::Kanji {
+                            text: kanji.text,
+                            reading: r.text,
+                        }]
+                    })
+                });
+                consider(word, priority_rank(kanji.priority), entry, spans);
+            }
+        }
+        for reading in entry.reading_elements() {
+            if let Some(&word) = wanted.get(reading.text) {
+                let spans = vec![ReadingSpan::Kana { text: reading.text }];
+                consider(word, priority_rank(reading.priority), entry, Some(spans));
+            }
+        }
+    }
+
+    let mut matches = Vec::new();
+    let mut unresolved = Vec::new();
+    for word in words {
+        match best.get(word) {
+            Some((_, _, entry, spans)) => matches.push((*entry, spans.clone())),
+            None => unresolved.push(word.to_string()),
+        }
+    }
+    FuriganaResults {
+        matches: matches.into_iter(),
+        unresolved,
+    }
+}
+
+///An iterator over the entries and furigana found by [furigana_for()], in the order of the input
+///words.
+#[derive(Clone, Debug)]
+pub struct FuriganaResults {
+    matches: std::vec::IntoIter<(Entry, Vec<ReadingSpan>)>,
+    unresolved: Vec<String>,
+}
+
+impl FuriganaResults {
+    ///Returns the input words that did not match any entry, in the order of the input.
+    pub fn unresolved(&self) -> &[String] {
+        &self.unresolved
+    }
+}
+
+impl std::iter::Iterator for FuriganaResults {
+    type Item = (Entry, Vec<ReadingSpan>);
+
+    fn next(&mut self) -> Option<Self::Item> {
+        self.matches.next()
+    }
+
+    fn size_hint(&self) -> (usize, Option<usize>) {
+        self.matches.size_hint()
+    }
+}
+
+pub(crate) fn align(text: &'static str, reading: &'static str) -> Option<Vec<ReadingSpan>> {
+    let mut spans = Vec::new();
+    if align_runs(&split_runs(text), reading, &mut spans) {
+        Some(spans)
+    } else {
+        None
+    }
+}
+
+///Splits the text into alternating runs of kana and non-kana characters. The small ヵ and ヶ are
+///counted as non-kana since they abbreviate 箇 and are not read as written.
+fn split_runs(text: &'static str) -> Vec<(bool, &'static str)> {
+    let is_kana = |c| kana::is_kana(c) && c != 'ヵ' && c != 'ヶ';
+    let mut runs = Vec::new();
+    let mut start = 0;
+    let mut current = None;
+    for (idx, c) in text.char_indices() {
+        let kana = is_kana(c);
+        if current.map_or(false, |k| k != kana) {
+            runs.push((current.unwrap(), &text[start..idx]));
+            start = idx;
+        }
+        current = Some(kana);
+    }
+    if let Some(kana) = current {
+        runs.push((kana, &text[start..]));
+    }
+    runs
+}
+
+///Backtracking search for an alignment of the runs with the reading. Kana runs must match the
+///reading literally (up to the hiragana/katakana distinction), and each kanji run must cover at
+///least one character of the reading. Shorter readings for kanji runs are tried first.
+fn align_runs(
+    runs: &[(bool, &'static str)],
+    reading: &'static str,
+    spans: &mut Vec<ReadingSpan>,
+) -> bool {
+    let (is_kana, text) = match runs.first() {
+        Some(run) => *run,
+        None => return reading.is_empty(),
+    };
+
+    if is_kana {
+        let len = match strip_kana_prefix(reading, text) {
+            Some(len) => len,
+            None => return false,
+        };
+        spans.push(ReadingSpan::Kana { text });
+        if align_runs(&runs[1..], &reading[len..], spans) {
+            return true;
+        }
+        spans.pop();
+        return false;
+    }
+
+    for (idx, c) in reading.char_indices() {
+        let len = idx + c.len_utf8();
+        spans.push(ReadingSpan::Kanji {
+            text,
+            reading: &reading[..len],
+        });
+        if align_runs(&runs[1..], &reading[len..], spans) {
+            return true;
+        }
+        spans.pop();
+    }
+    false
+}
+
+///If `reading` starts with the kana in `prefix`, returns the length of the matching part of
+///`reading` in bytes.
+fn strip_kana_prefix(reading: &str, prefix: &str) -> Option<usize> {
+    let mut reading_chars = reading.char_indices();
+    for p in prefix.chars() {
+        match reading_chars.next() {
+            Some((_, r)) if kana::to_hiragana(r) == kana::to_hiragana(p) => {}
+            _ => return None,
+        }
+    }
+    Some(reading_chars.next().map_or(reading.len(), |(idx, _)| idx))
+}
@@ -0,0 +1,55 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+use std::collections::BTreeMap;
+
+///Groups entries by reading, and yields each reading that is shared by more than one entry, e.g.
+///はし for 橋 (bridge), 箸 (chopsticks) and 端 (edge). This is intended for building homophone
+///drills.
+///
+///Readings are compared by their exact text, so はし and ハシ form separate groups. Search-only
+///reading elements (see [ReadingElement::is_search_only()]) are ignored, since they are usually
+///misspellings rather than actual homophones.
+///
+///Groups are ordered by reading. Within each group, entries are ordered by the priority of the
+///shared reading element: common words come first, then words with a better frequency bucket,
+///and ties are broken by sequence number.
+///
+///The grouping is computed in full when this function is called, which requires a scan over all
+///reading elements.
+pub fn homophones() -> impl Iterator<Item = (String, Vec<Entry>)> {
+    let mut by_reading: BTreeMap<&'static str, Vec<(u32, u32, Entry)>> = BTreeMap::new();
+    for entry in entries() {
+        for reading in entry.reading_elements().filter(|r| !r.is_search_only()) {
+            let candidates = by_reading.entry(reading.text).or_default();
+            //the same reading can occur in one entry multiple times in theory
+            if candidates.iter().all(|(_, n, _)| *n != entry.number) {
+                candidates.push((priority_rank(reading.priority), entry.number, entry));
+            }
+        }
+    }
+
+    by_reading
+        .into_iter()
+        .filter(|(_, candidates)| candidates.len() > 1)
+        .map(|(text, mut candidates)| {
+            candidates.sort_by_key(|(rank, number, _)| (*rank, *number));
+            let group = candidates.into_iter().map(|(_, _, e)| e).collect();
+            (text.to_string(), group)
+        })
+}
+
+//Lower is better. Common words come first, then words by frequency bucket (where 0 means that
+//there is no bucket).
+pub(crate) fn priority_rank(p: Priority) -> u32 {
+    let uncommon = if p.is_common() { 0 } else { 1 };
+    let bucket: u32 = match p.frequency_bucket {
+        0 => 49,
+        b => b.into(),
+    };
+    uncommon * 50 + bucket
+}
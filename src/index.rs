@@ -0,0 +1,74 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Lookups in the inverted indexes that are generated at build time when the respective
+//! `index-XXX` features are enabled.
+
+use crate::*;
+use std::convert::TryInto;
+
+///Returns all entries where at least one kanji element contains the given kanji character. Common
+///words come first, ordered by their frequency ranking if available; otherwise, entries appear in
+///the same order as in [entries()].
+///
+///This is only available with the `index-kanji` feature, which adds an index to the binary that
+///maps each kanji to the entries containing it.
+///
+///```
+///let entry = jmdict::entries_containing_kanji('母').find(|e| e.number == 1002650);
+///assert!(entry.is_some());
+///```
+#[cfg(feature = "index-kanji")]
+pub fn entries_containing_kanji(c: char) -> impl Iterator<Item = Entry> {
+    let (keys, values) = kanji_index();
+    lookup(keys, values, c as u32)
+        .iter()
+        .map(|&idx| get_entry(idx.try_into().unwrap()))
+}
+
+///Returns all entries, ordered by how frequently they are used. This is intended for walking
+///through the vocabulary in a sensible learning order, e.g. for spaced repetition.
+///
+///The order is determined by the best `jmdict_traverse::index::frequency_score()` across all
+///kanji elements and reading elements of each entry, which combines the
+///[PriorityInCorpus] fields and the frequency bucket of [Priority]. Entries with the same score
+///are ordered by sequence number.
+///
+///This is only available with the `index-frequency` feature, which adds the precomputed order to
+///the binary.
+///
+///```
+///let first = jmdict::entries_by_frequency().next().unwrap();
+///assert!(first.reading_elements().any(|r| r.priority.is_common()));
+///```
+#[cfg(feature = "index-frequency")]
+pub fn entries_by_frequency() -> impl Iterator<Item = Entry> {
+    frequency_order()
+        .iter()
+        .map(|&idx| get_entry(idx.try_into().unwrap()))
+}
+
+///Finds the list of entry indexes for the given key in an index. See
+///`jmdict_traverse::index::IndexBuilder::encode()` for the format.
+#[cfg(feature = "index-kanji")]
+fn lookup(keys: &'static [u32], values: &'static [u32], key: u32) -> &'static [u32] {
+    //binary search over the (key, start, end) triples
+    let (mut lo, mut hi) = (0, keys.len() / 3);
+    while lo < hi {
+        let mid = (lo + hi) / 2;
+        let triple = &keys[(mid * 3)..(mid * 3 + 3)];
+        if triple[0] == key {
+            let start = triple[1].try_into().unwrap();
+            let end = triple[2].try_into().unwrap();
+            return &values[start..end];
+        } else if triple[0] < key {
+            lo = mid + 1;
+        } else {
+            hi = mid;
+        }
+    }
+    &[]
+}
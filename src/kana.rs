@@ -0,0 +1,92 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Character classification helpers for the kana scripts. These are used by the various heuristics
+//! on [ReadingElement](crate::ReadingElement) and [Entry](crate::Entry).
+
+///Whether this character is a katakana character, including the halfwidth forms and the phonetic
+///extensions used for Ainu.
+pub(crate) fn is_katakana(c: char) -> bool {
+    matches!(
+        c,
+        '\u{30A1}'..='\u{30FA}'
+            | '\u{30FD}'..='\u{30FF}'
+            | '\u{31F0}'..='\u{31FF}'
+            | '\u{FF66}'..='\u{FF6F}'
+            | '\u{FF71}'..='\u{FF9D}'
+    )
+}
+
+///Whether this character may appear in katakana text without being katakana itself: the
+///prolonged sound mark (`ー`), the middle dot (`・`) and their halfwidth forms, as well as the
+///voicing marks.
+pub(crate) fn is_katakana_compatible(c: char) -> bool {
+    matches!(
+        c,
+        '\u{30FB}'
+            | '\u{30FC}'
+            | '\u{FF65}'
+            | '\u{FF70}'
+            | '\u{FF9E}'
+            | '\u{FF9F}'
+            | '\u{309B}'
+            | '\u{309C}'
+    )
+}
+
+///Whether this character is a hiragana character.
+pub(crate) fn is_hiragana(c: char) -> bool {
+    matches!(c, '\u{3041}'..='\u{3096}' | '\u{309D}'..='\u{309F}')
+}
+
+///Whether this character is written in kana, i.e. it is hiragana, katakana or one of the
+///characters accepted by [is_katakana_compatible()].
+pub(crate) fn is_kana(c: char) -> bool {
+    is_hiragana(c) || is_katakana(c) || is_katakana_compatible(c)
+}
+
+///Maps fullwidth katakana to the corresponding hiragana, and leaves all other characters
+///unchanged. This is used for comparing kana regardless of the script they are written in.
+pub(crate) fn to_hiragana(c: char) -> char {
+    match c {
+        '\u{30A1}'..='\u{30F6}' | '\u{30FD}'..='\u{30FE}' => {
+            std::char::from_u32(c as u32 - 0x60).unwrap()
+        }
+        _ => c,
+    }
+}
+
+///Counts the morae in the given kana text. See
+///[ReadingElement::mora_count()](crate::ReadingElement::mora_count()) for the counting convention.
+pub(crate) fn mora_count(text: &str) -> usize {
+    let mut count = 0;
+    for c in text.chars() {
+        if !is_kana(c) || matches!(c, '\u{30FB}' | '\u{FF65}') {
+            //non-kana characters and the middle dot do not count
+            continue;
+        }
+        if count > 0 && combines_with_previous(c) {
+            continue;
+        }
+        count += 1;
+    }
+    count
+}
+
+///Whether this kana forms a single mora together with the preceding kana: small kana other than
+///the sokuon (e.g. `ゃ` in `きゃ` or `ァ` in `ファ`), and the standalone voicing marks.
+fn combines_with_previous(c: char) -> bool {
+    matches!(
+        to_hiragana(c),
+        'ぁ' | 'ぃ' | 'ぅ' | 'ぇ' | 'ぉ' | 'ゃ' | 'ゅ' | 'ょ' | 'ゎ'
+            | '\u{31F0}'..='\u{31FF}'
+            | '\u{FF67}'..='\u{FF6E}'
+            | '\u{309B}'
+            | '\u{309C}'
+            | '\u{FF9E}'
+            | '\u{FF9F}'
+    )
+}
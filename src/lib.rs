@@ -39,6 +39,26 @@
 //! assert_eq!(reading_form, "おかあさん");
 //! ```
 //!
+//! To import the most commonly used types and functions at once, use `jmdict::prelude::*`.
+//!
+//! # Error handling
+//!
+//! The JMdict is parsed and validated at compile-time, so malformed data (e.g. an unknown entity
+//! in the entrypack) fails the build of this crate instead of failing at runtime. Accessing the
+//! embedded database therefore cannot fail, and this crate does not have an error type:
+//!
+//! * Functions that iterate over the database, like [entries()] or [Query::entries()], are
+//!   infallible.
+//! * Lookups that may not find anything, like [entry_by_permalink()],
+//!   [CrossReference::resolve()] or [Enum::from_code()], return `Option` instead of panicking,
+//!   including for malformed inputs.
+//! * With the `compressed-embed` feature, the database is decompressed on first access. This only
+//!   fails if the binary itself is corrupted, which is treated like any other internal error.
+//!
+//! Panics are reserved for violated invariants of the embedded database (e.g. an entry without
+//! reading elements), which would indicate a bug in this crate. Errors in the input data are
+//! reported by the build script, which uses `jmdict_traverse::LoadError` for this purpose.
+//!
 //! # Cargo features
 //!
 //! ### Common configurations
@@ -75,6 +95,25 @@
 //! languages. For example, in the default configuration, `GlossLanguage::English` will be the only
 //! variant. (The [AllGlossLanguage] enum always contains all variants.)
 //!
+//! ### Binary size: `compressed-embed`
+//!
+//! By default, the database is embedded into the binary in a form that can be accessed directly.
+//! When the `compressed-embed` feature is enabled, the database is embedded in gzipped form
+//! instead, and decompressed into the heap on first access. This shrinks the embedded data to
+//! about 40% of its original size (e.g. from about 5.6 MiB to 2.1 MiB in the `default`
+//! configuration, or from about 67 MiB to 25 MiB with `full`), but the first access to the
+//! database is delayed by the decompression (a few tens of milliseconds with `default`, up to
+//! about a second with `full`), and the decompressed database occupies the same amount of heap
+//! memory for the rest of the program's runtime. This feature requires Rust 1.70 or newer.
+//!
+//! ### Indexes
+//!
+//! Some lookups would require a full scan over all entries. The following features add indexes to
+//! the binary to speed them up, at the cost of binary size:
+//!
+//! * `index-kanji`: adds [entries_containing_kanji()]
+//! * `index-frequency`: adds [entries_by_frequency()]
+//!
 //! ### Crippled builds: `db-minimal`
 //!
 //! When the `db-minimal` feature is enabled, only a severly reduced portion of the JMdict will
@@ -92,21 +131,131 @@ pub use jmdict_enums::{
     AllGlossLanguage, AllPartOfSpeech, Dialect, DisabledVariant, Enum, GlossLanguage, GlossType,
     KanjiInfo, PartOfSpeech, Priority, PriorityInCorpus, ReadingInfo, SenseInfo, SenseTopic,
 };
+mod audit;
+pub use audit::find_okurigana_variants;
+mod format;
+pub use format::dedup_glosses;
+mod furigana;
+pub use furigana::{furigana_for, FuriganaResults, ReadingSpan};
+mod homophones;
+pub use homophones::homophones;
+#[cfg(any(feature = "index-kanji", feature = "index-frequency"))]
+mod index;
+#[cfg(feature = "index-frequency")]
+pub use index::entries_by_frequency;
+#[cfg(feature = "index-kanji")]
+pub use index::entries_containing_kanji;
+mod kana;
 mod payload;
 use payload::*;
+mod permalink;
+pub use permalink::entry_by_permalink;
+mod pos;
+pub use pos::Transitivity;
+pub mod prelude;
+mod query;
+pub use query::{entries_with_mora_count, modern_entries, search_anywhere, Query, QueryResults};
+mod romaji;
+pub use romaji::{kana_to_romaji, RomajiStyle};
+mod stats;
+pub use stats::{common_entry_count, count_where, entry_count, entry_count_for_language};
+mod suggest;
+pub use suggest::suggest_readings;
+mod xref;
+pub use xref::{
+    validate_cross_references, BrokenReference, CrossReference, ReferenceKind, ResolvedEntry,
+    ResolvedReference,
+};
 
+#[cfg(test)]
+mod test_audit;
 #[cfg(test)]
 mod test_consistency;
 #[cfg(test)]
 mod test_feature_matrix;
 #[cfg(test)]
+mod test_format;
+#[cfg(test)]
+mod test_furigana;
+#[cfg(test)]
+mod test_homophones;
+#[cfg(test)]
+mod test_index;
+#[cfg(test)]
+mod test_kana;
+#[cfg(test)]
 mod test_ordering;
+#[cfg(test)]
+mod test_permalink;
+#[cfg(test)]
+mod test_pos;
+#[cfg(test)]
+mod test_query;
+#[cfg(test)]
+mod test_romaji;
+#[cfg(test)]
+mod test_stats;
+#[cfg(test)]
+mod test_suggest;
+#[cfg(test)]
+mod test_xref;
 
 ///Returns an iterator over all entries in the database.
 pub fn entries() -> Entries {
     Entries::new()
 }
 
+///Returns the creation date of the JMdict file that the embedded database was generated from, in
+///the format `YYYY-MM-DD`. This is useful for telling users how recent the dictionary data is.
+///
+///The date is taken from the header line of the entrypack (see `data/README.md`). It is `None` if
+///the entrypack was generated by an older version of the preprocessor that did not record the date
+///yet, or if the JMdict file did not state its creation date.
+pub fn jmdict_date() -> Option<&'static str> {
+    payload::JMDICT_DATE
+}
+
+///Returns the gloss languages that are included in this build, as selected by the
+///`translations-XXX` features. This is the same as `GlossLanguage::all_variants()`.
+///
+///When Cargo unifies features across the dependency graph, more languages may end up being
+///compiled in than your application selected. Printing this list is a quick way to check.
+pub fn compiled_languages() -> &'static [GlossLanguage] {
+    GlossLanguage::all_variants()
+}
+
+///A set of gloss languages, as returned by [Entry::available_languages()]. This is stored as a
+///bitset, so it can be copied and queried cheaply.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Hash)]
+pub struct LanguageSet(u32);
+
+impl LanguageSet {
+    pub fn contains(&self, lang: GlossLanguage) -> bool {
+        self.0 & (1 << jmdict_enums::EnumPayload::to_u32(&lang)) != 0
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.0 == 0
+    }
+
+    ///Returns the languages in this set, in the order of [compiled_languages()].
+    pub fn iter(&self) -> impl Iterator<Item = GlossLanguage> {
+        let set = *self;
+        compiled_languages()
+            .iter()
+            .copied()
+            .filter(move |&lang| set.contains(lang))
+    }
+}
+
+///Returns all distinct lists of parts of speech that occur in [Sense::parts_of_speech()] within
+///this build, in order of first occurrence. This is computed at build time, so it can be used to
+///populate filter UIs without scanning all entries. Senses without parts of speech are not
+///considered.
+pub fn observed_pos_combinations() -> impl Iterator<Item = &'static [PartOfSpeech]> {
+    ALL_POS_COMBINATIONS.iter().copied()
+}
+
 ///An entry in the JMdict dictionary.
 ///
 ///Each entry has zero or more [kanji elements](KanjiElement), one or more
@@ -114,6 +263,25 @@ pub fn entries() -> Entries {
 ///Japanese representation of the vocabulary or phrase. Whereas reading elements consist of only
 ///kana, kanji elements will contain characters from non-kana scripts, most commonly kanji. Senses
 ///contain the translation of the vocabulary or phrase in other languages, most commonly English.
+///
+///Senses without glosses in any of the selected `translations-XXX` languages are dropped at build
+///time, and so are entries without any senses left. Code that does not want to rely on this, e.g.
+///because it handles entries from other sources, can check [Entry::has_any_gloss()]. Entries
+///without senses behave in the obvious way: [Entry::senses()] yields nothing,
+///[Entry::short_gloss()] returns `None`, and the display helpers only render the headword.
+///
+///Entries only refer to the database that is embedded into the binary, so they are `'static`,
+///`Copy`, `Send` and `Sync`. They can be stored for as long as needed (e.g. in a list of favorites)
+///and moved to other threads without copying any of their contents:
+///
+///```
+///let entry = jmdict::entries().next().unwrap();
+///let number = std::thread::spawn(move || entry.number).join().unwrap();
+///assert_eq!(number, entry.number);
+///```
+///
+///To refer to an entry across program runs or database updates, store its
+///[permalink ID](Entry::permalink_id()) instead.
 #[derive(Clone, Copy, Debug)]
 pub struct Entry {
     ///The sequence number for this Entry as it appears in the JMdict. Numbers start around 1000000
@@ -124,6 +292,7 @@ pub struct Entry {
     kanji_elements_iter: KanjiElements,
     reading_elements_iter: ReadingElements,
     senses_iter: Senses,
+    languages: LanguageSet,
 }
 
 impl Entry {
@@ -138,6 +307,106 @@ impl Entry {
     pub fn senses(&self) -> Senses {
         self.senses_iter
     }
+
+    ///Returns the set of languages that this entry has glosses in. This is computed at build
+    ///time, so unlike iterating over all senses and glosses, it is very cheap.
+    pub fn available_languages(&self) -> LanguageSet {
+        self.languages
+    }
+
+    ///Whether this entry has any glosses in the given language. This is a shorthand for
+    ///`self.available_languages().contains(lang)`.
+    pub fn has_gloss_language(&self, lang: GlossLanguage) -> bool {
+        self.languages.contains(lang)
+    }
+
+    ///Whether this entry has any glosses at all. UIs can use this to show a placeholder like "no
+    ///definition available" instead of an empty list of senses. To check for glosses in a
+    ///particular language, use [Entry::has_gloss_language()] instead.
+    pub fn has_any_gloss(&self) -> bool {
+        !self.languages.is_empty()
+    }
+
+    ///A cheap heuristic for detecting loanwords: Returns true if the first [ReadingElement] of
+    ///this entry is written entirely in katakana, or if any [Sense] has [LoanwordSources].
+    ///
+    ///This is not exact. Many loanwords do not list their sources in the JMdict, and katakana is
+    ///also used for onomatopoeia, for emphasis, and for plant and animal names.
+    pub fn is_likely_loanword(&self) -> bool {
+        let has_katakana_reading = self
+            .reading_elements()
+            .next()
+            .map_or(false, |r| r.is_katakana());
+        has_katakana_reading || self.senses().any(|s| s.loanword_sources().len() > 0)
+    }
+
+    ///Returns the texts of all kanji elements of this entry, followed by the texts of all reading
+    ///elements. This includes all forms regardless of their [KanjiInfo] or [ReadingInfo], so it
+    ///is what a search index should contain. See [Entry::searchable_forms()] for a filtered list.
+    pub fn all_forms(&self) -> impl Iterator<Item = &'static str> {
+        self.kanji_elements()
+            .map(|k| k.text)
+            .chain(self.reading_elements().map(|r| r.text))
+    }
+
+    ///Like [Entry::all_forms()], but skips forms that the JMdict marks as search-only (see
+    ///[KanjiElement::is_search_only()] and [ReadingElement::is_search_only()]). Those are
+    ///mostly common misspellings that are only included so that lookups for them succeed, so
+    ///this list is more appropriate for matching against well-formed text.
+    pub fn searchable_forms(&self) -> impl Iterator<Item = &'static str> {
+        self.kanji_elements()
+            .filter(|k| !k.is_search_only())
+            .map(|k| k.text)
+            .chain(
+                self.reading_elements()
+                    .filter(|r| !r.is_search_only())
+                    .map(|r| r.text),
+            )
+    }
+
+    ///Returns the senses of this entry that have glosses in the given language. Each sense only
+    ///exposes the glosses in that language, so this is the easiest way to avoid displaying
+    ///glosses in other languages when multiple `translations-XXX` features are enabled.
+    pub fn senses_for_language(
+        &self,
+        lang: GlossLanguage,
+    ) -> impl Iterator<Item = LanguageScopedSense> {
+        self.senses()
+            .filter(move |s| s.has_language(lang))
+            .map(move |sense| LanguageScopedSense {
+                sense,
+                language: lang,
+            })
+    }
+
+    ///Returns the number of senses of this entry. This is the same as `self.senses().len()`, and
+    ///does not require decoding any of the senses.
+    pub fn sense_count(&self) -> usize {
+        self.senses().len()
+    }
+
+    ///Returns the number of glosses in the given language across all senses of this entry. This
+    ///is the same as the total number of glosses yielded by [Entry::senses_for_language()], but
+    ///does not require constructing the intermediate iterators. Returns 0 immediately if
+    ///[Entry::has_gloss_language()] is false.
+    pub fn gloss_count(&self, lang: GlossLanguage) -> usize {
+        if !self.has_gloss_language(lang) {
+            return 0;
+        }
+        self.senses()
+            .map(|s| s.glosses().filter(|g| g.language == lang).count())
+            .sum()
+    }
+
+    ///Returns the first gloss in the given language, taken from the first [Sense] that has glosses
+    ///in that language. This is useful as a brief summary of the entry's meaning, e.g. in lists of
+    ///search results. Returns `None` if there are no glosses in the given language.
+    pub fn short_gloss(&self, lang: GlossLanguage) -> Option<&'static str> {
+        self.senses()
+            .flat_map(|s| s.glosses())
+            .find(|g| g.language == lang)
+            .map(|g| g.text)
+    }
 }
 
 ///A representation of a dictionary entry using kanji or other non-kana scripts.
@@ -155,6 +424,18 @@ impl KanjiElement {
     pub fn infos(&self) -> KanjiInfos {
         self.info_iter
     }
+
+    ///Whether this kanji element is marked as search-only. Such forms (mostly common misspellings)
+    ///should be found when searching for them, but should not be displayed.
+    pub fn is_search_only(&self) -> bool {
+        self.infos().any(|i| i == KanjiInfo::SearchOnlyKanjiForm)
+    }
+
+    ///Whether this kanji element is marked as [ateji](KanjiInfo::Ateji), i.e. kanji that are used
+    ///for their sound rather than their meaning, like 屹度 for きっと.
+    pub fn is_ateji(&self) -> bool {
+        self.infos().any(|i| i == KanjiInfo::Ateji)
+    }
 }
 
 ///A representation of a dictionary entry using only kana.
@@ -167,12 +448,76 @@ pub struct ReadingElement {
     pub text: &'static str,
     pub priority: Priority,
     info_iter: ReadingInfos,
+    restrictions_iter: Strings,
+    is_nokanji: bool,
 }
 
 impl ReadingElement {
     pub fn infos(&self) -> ReadingInfos {
         self.info_iter
     }
+
+    ///Returns the kanji elements of the given entry that this reading applies to. If the reading
+    ///is restricted to certain kanji elements, only those are returned. If the reading is not a
+    ///true reading of any kanji element (e.g. because it is a foreign word written in katakana),
+    ///the result is empty.
+    ///
+    ///The given entry must be the one containing this reading element.
+    pub fn applicable_kanji(&self, entry: &Entry) -> Vec<KanjiElement> {
+        if self.is_nokanji {
+            return Vec::new();
+        }
+        let restrictions: Vec<&'static str> = self.restrictions_iter.collect();
+        entry
+            .kanji_elements()
+            .filter(|k| restrictions.is_empty() || restrictions.contains(&k.text))
+            .collect()
+    }
+
+    ///Whether this reading applies to all kanji elements of its entry, i.e. it is neither
+    ///restricted to certain kanji elements (`<re_restr>` in the JMdict) nor marked as not being a
+    ///true reading of the kanji (`<re_nokanji>`). Dictionaries usually list these readings first.
+    ///
+    ///This is also true for readings of entries without kanji elements, unless they are marked
+    ///with `<re_nokanji>`.
+    pub fn is_unrestricted(&self) -> bool {
+        !self.is_nokanji && self.restrictions_iter.len() == 0
+    }
+
+    ///Whether this reading element is marked as search-only. Such forms (mostly common
+    ///misspellings) should be found when searching for them, but should not be displayed.
+    pub fn is_search_only(&self) -> bool {
+        self.infos().any(|i| i == ReadingInfo::SearchOnlyKanaForm)
+    }
+
+    ///Whether this reading element is marked as [gikun or jukujikun](ReadingInfo::GikunOrJukujikun),
+    ///i.e. a reading that is assigned to the kanji because of their meaning rather than their
+    ///usual readings, like のり for 海苔.
+    pub fn is_gikun(&self) -> bool {
+        self.infos().any(|i| i == ReadingInfo::GikunOrJukujikun)
+    }
+
+    ///Whether this reading is written entirely in katakana. The prolonged sound mark (`ー`) and
+    ///the middle dot (`・`) are accepted as part of katakana text, but a reading consisting only of
+    ///those is not considered katakana.
+    pub fn is_katakana(&self) -> bool {
+        self.text
+            .chars()
+            .all(|c| kana::is_katakana(c) || kana::is_katakana_compatible(c))
+            && self.text.chars().any(kana::is_katakana)
+    }
+
+    ///Counts the morae (the rhythmic units of Japanese, as counted e.g. in haiku) in this reading.
+    ///The following convention is used:
+    ///
+    ///* Each kana counts as one mora, including the moraic nasal (`ん`), the sokuon (`っ`) and the
+    ///  prolonged sound mark (`ー`). For example, がっこう and コーヒー both have 4 morae.
+    ///* Small kana other than the sokuon combine with the preceding kana into one mora, so きょう
+    ///  has 2 morae and ファン has 2 morae.
+    ///* Characters other than kana, as well as the middle dot (`・`), do not count.
+    pub fn mora_count(&self) -> usize {
+        kana::mora_count(self.text)
+    }
 }
 
 ///The translational equivalent of a Japanese word or phrase.
@@ -214,6 +559,14 @@ impl Sense {
         self.stagr_iter
     }
 
+    ///Returns the parts of speech of this sense. In the JMdict, the parts of speech of a sense
+    ///apply to the following senses until a new part of speech is given. This inheritance is
+    ///already resolved at build time, so each sense reports its effective parts of speech.
+    ///
+    ///Inheritance only applies between senses with glosses in the same language. The JMdict only
+    ///gives parts of speech for the English senses, so senses with glosses in other languages
+    ///usually have no parts of speech at all. To find the part of speech of such a sense, look at
+    ///the English senses of the same entry (if the `translations-eng` feature is enabled).
     pub fn parts_of_speech(&self) -> PartsOfSpeech {
         self.pos_iter
     }
@@ -224,13 +577,13 @@ impl Sense {
     ///cross-reference. Where this happens, a katakana middle dot (`・`, U+30FB) is placed between
     ///the components of the cross-reference.
     ///
-    ///TODO: Provide a structured type for these kinds of references.
+    ///Use [CrossReference::parse()] to obtain a structured representation of these references.
     pub fn cross_references(&self) -> Strings {
         self.cross_refs_iter
     }
 
     ///If not empty, contains the text of [KanjiElements] or [ReadingElements] of other [Entries]
-    ///which are antonyms of this sense.
+    ///which are antonyms of this sense. The format is the same as for [Sense::cross_references()].
     pub fn antonyms(&self) -> Strings {
         self.antonyms_iter
     }
@@ -243,6 +596,17 @@ impl Sense {
         self.info_iter
     }
 
+    ///Whether this sense is marked as archaic, obsolete or rare. Learners usually want to hide
+    ///these senses.
+    pub fn is_archaic_or_rare(&self) -> bool {
+        self.infos().any(|i| {
+            matches!(
+                i,
+                SenseInfo::Archaism | SenseInfo::ObsoleteTerm | SenseInfo::Rare
+            )
+        })
+    }
+
     ///If not empty, contains additional information about this sence (e.g. level of currency or
     ///other nuances) that cannot be expressed by the other, more structured fields.
     pub fn freetext_infos(&self) -> Strings {
@@ -260,9 +624,77 @@ impl Sense {
         self.dialects_iter
     }
 
+    ///Returns the glosses of this sense in the same order as in the JMdict. Within each language,
+    ///the JMdict orders glosses by significance, so the first gloss is usually the best
+    ///translation. This order is guaranteed to be preserved.
     pub fn glosses(&self) -> Glosses {
         self.glosses_iter
     }
+
+    ///Returns the glosses of this sense in the given languages. The result is grouped by language
+    ///in the order given in `langs`. Within each language, glosses appear in the same order as in
+    ///[Sense::glosses()].
+    pub fn glosses_multi(&self, langs: &[GlossLanguage]) -> Vec<Gloss> {
+        langs
+            .iter()
+            .flat_map(|&lang| self.glosses().filter(move |g| g.language == lang))
+            .collect()
+    }
+
+    ///Returns the distinct languages of the glosses in this sense, in order of first appearance.
+    ///Senses in the JMdict usually only contain glosses in a single language.
+    pub fn languages(&self) -> impl Iterator<Item = GlossLanguage> {
+        let mut result = Vec::new();
+        for gloss in self.glosses() {
+            if !result.contains(&gloss.language) {
+                result.push(gloss.language);
+            }
+        }
+        result.into_iter()
+    }
+
+    ///Whether this sense contains at least one gloss in the given language.
+    pub fn has_language(&self, lang: GlossLanguage) -> bool {
+        self.glosses().any(|g| g.language == lang)
+    }
+}
+
+///A [Sense] as seen through the lens of a single [GlossLanguage]. This is returned by
+///[Entry::senses_for_language()].
+///
+///All methods of [Sense] are available through `Deref`, except that [LanguageScopedSense::glosses()]
+///only yields glosses in the selected language. Use [LanguageScopedSense::sense()] to access all
+///glosses.
+#[derive(Clone, Copy, Debug)]
+pub struct LanguageScopedSense {
+    sense: Sense,
+    language: GlossLanguage,
+}
+
+impl LanguageScopedSense {
+    ///Returns the underlying [Sense], including glosses in all languages.
+    pub fn sense(&self) -> Sense {
+        self.sense
+    }
+
+    ///Returns the language that this sense is scoped to.
+    pub fn language(&self) -> GlossLanguage {
+        self.language
+    }
+
+    ///Returns the glosses of this sense in the selected language. This is never empty.
+    pub fn glosses(&self) -> impl Iterator<Item = Gloss> {
+        let language = self.language;
+        self.sense.glosses().filter(move |g| g.language == language)
+    }
+}
+
+impl std::ops::Deref for LanguageScopedSense {
+    type Target = Sense;
+
+    fn deref(&self) -> &Sense {
+        &self.sense
+    }
 }
 
 ///A source word in other language which a particular [Sense] of an [Entry] has been borrowed from.
@@ -334,7 +766,7 @@ macro_rules! wrap_iterator {
 
 wrap_iterator!(KanjiElement, 5, KanjiElements);
 wrap_iterator!(KanjiInfo, 1, KanjiInfos);
-wrap_iterator!(ReadingElement, 5, ReadingElements);
+wrap_iterator!(ReadingElement, 6, ReadingElements);
 wrap_iterator!(ReadingInfo, 1, ReadingInfos);
 wrap_iterator!(Sense, 5, Senses);
 wrap_iterator!(&'static str, 2, Strings);
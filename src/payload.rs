@@ -43,7 +43,7 @@ impl<T: FromPayload<N>, const N: usize> std::iter::Iterator for Range<T, N> {
 
     fn next(&mut self) -> Option<Self::Item> {
         if self.start < self.end {
-            let data = &as_u32_slice(ALL_DATA)[self.start..(self.start + N)];
+            let data = &all_data()[self.start..(self.start + N)];
             let item = T::get(data.try_into().unwrap());
             self.start += N;
             Some(item)
@@ -73,7 +73,7 @@ pub(crate) fn entry_count() -> usize {
 
 pub(crate) fn get_entry(idx: usize) -> Entry {
     let offset: usize = as_u32_slice(ALL_ENTRY_OFFSETS)[idx].try_into().unwrap();
-    let data = &as_u32_slice(ALL_DATA)[offset..(offset + 4)];
+    let data = &all_data()[offset..(offset + 5)];
 
     let (start, end) = (data[0], data[1]);
     let mid1 = start + (data[2] & 0x0000FFFF);
@@ -84,6 +84,7 @@ pub(crate) fn get_entry(idx: usize) -> Entry {
         kanji_elements_iter: Range::new(start, mid1).into(),
         reading_elements_iter: Range::new(mid1, mid2).into(),
         senses_iter: Range::new(mid2, end).into(),
+        languages: LanguageSet(data[4]),
     }
 }
 
@@ -103,12 +104,16 @@ impl FromPayload<1> for KanjiInfo {
     }
 }
 
-impl FromPayload<5> for ReadingElement {
-    fn get(data: &[u32; 5]) -> Self {
+impl FromPayload<6> for ReadingElement {
+    fn get(data: &[u32; 6]) -> Self {
+        let (start, end) = (data[3], data[4]);
+        let mid = start + (data[5] & 0x7FFFFFFF);
         Self {
             priority: jmdict_enums::EnumPayload::from_u32(data[0]),
             text: get_str(data[1], data[2]),
-            info_iter: Range::new(data[3], data[4]).into(),
+            info_iter: Range::new(start, mid).into(),
+            restrictions_iter: Range::new(mid, end).into(),
+            is_nokanji: (data[5] & 0x80000000) == 0x80000000,
         }
     }
 }
@@ -205,7 +210,7 @@ impl FromPayload<2> for &'static str {
 fn get_str(start: u32, end: u32) -> &'static str {
     let start = start.try_into().unwrap();
     let end = end.try_into().unwrap();
-    &ALL_TEXTS[start..end]
+    &all_texts()[start..end]
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -228,5 +233,91 @@ fn as_u32_slice(input: &'static [u8]) -> &'static [u32] {
 
 static ALL_ENTRY_OFFSETS: &[u8] =
     include_aligned!(Align16, concat!(env!("OUT_DIR"), "/entry_offsets.dat"));
+
+#[cfg(feature = "index-kanji")]
+static KANJI_INDEX_KEYS: &[u8] =
+    include_aligned!(Align16, concat!(env!("OUT_DIR"), "/kanji_index_keys.dat"));
+#[cfg(feature = "index-kanji")]
+static KANJI_INDEX_VALUES: &[u8] =
+    include_aligned!(Align16, concat!(env!("OUT_DIR"), "/kanji_index_values.dat"));
+
+///Returns the keys and values of the kanji index. See
+///`jmdict_traverse::index::IndexBuilder::encode()` for the format.
+#[cfg(feature = "index-kanji")]
+pub(crate) fn kanji_index() -> (&'static [u32], &'static [u32]) {
+    (
+        as_u32_slice(KANJI_INDEX_KEYS),
+        as_u32_slice(KANJI_INDEX_VALUES),
+    )
+}
+
+#[cfg(feature = "index-frequency")]
+static FREQUENCY_ORDER: &[u8] =
+    include_aligned!(Align16, concat!(env!("OUT_DIR"), "/frequency_order.dat"));
+
+///Returns the indexes of all entries, sorted by
+///`jmdict_traverse::index::sort_by_frequency()`.
+#[cfg(feature = "index-frequency")]
+pub(crate) fn frequency_order() -> &'static [u32] {
+    as_u32_slice(FREQUENCY_ORDER)
+}
+
+#[cfg(not(feature = "compressed-embed"))]
 static ALL_DATA: &[u8] = include_aligned!(Align16, concat!(env!("OUT_DIR"), "/payload.dat"));
+#[cfg(not(feature = "compressed-embed"))]
 static ALL_TEXTS: &str = include_str!(concat!(env!("OUT_DIR"), "/strings.txt"));
+
+#[cfg(not(feature = "compressed-embed"))]
+fn all_data() -> &'static [u32] {
+    as_u32_slice(ALL_DATA)
+}
+
+#[cfg(not(feature = "compressed-embed"))]
+fn all_texts() -> &'static str {
+    ALL_TEXTS
+}
+
+//With the "compressed-embed" feature, ALL_DATA and ALL_TEXTS are embedded in gzipped form and
+//unpacked into the heap on first access. The decompressed buffers live until the end of the
+//program, so we can keep handing out &'static references into them.
+
+#[cfg(feature = "compressed-embed")]
+static ALL_DATA_GZ: &[u8] = include_bytes!(concat!(env!("OUT_DIR"), "/payload.dat.gz"));
+#[cfg(feature = "compressed-embed")]
+static ALL_TEXTS_GZ: &[u8] = include_bytes!(concat!(env!("OUT_DIR"), "/strings.txt.gz"));
+
+#[cfg(feature = "compressed-embed")]
+fn all_data() -> &'static [u32] {
+    static ALL_DATA: std::sync::OnceLock<Vec<u32>> = std::sync::OnceLock::new();
+    ALL_DATA.get_or_init(|| {
+        decompress(ALL_DATA_GZ)
+            .chunks_exact(4)
+            .map(|chunk| u32::from_ne_bytes(chunk.try_into().unwrap()))
+            .collect()
+    })
+}
+
+#[cfg(feature = "compressed-embed")]
+fn all_texts() -> &'static str {
+    static ALL_TEXTS: std::sync::OnceLock<String> = std::sync::OnceLock::new();
+    ALL_TEXTS.get_or_init(|| String::from_utf8(decompress(ALL_TEXTS_GZ)).unwrap())
+}
+
+#[cfg(feature = "compressed-embed")]
+fn decompress(input: &[u8]) -> Vec<u8> {
+    use std::io::Read;
+    let mut decoder = libflate::gzip::Decoder::new(input).unwrap();
+    let mut buf = Vec::new();
+    decoder.read_to_end(&mut buf).unwrap();
+    buf
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// precomputed data
+//
+//Unlike the files above, these are generated by build.rs as Rust code, see write_pos_combinations(),
+//write_entry_counts() and write_pack_info() over there.
+
+include!(concat!(env!("OUT_DIR"), "/pos_combinations.rs"));
+include!(concat!(env!("OUT_DIR"), "/entry_counts.rs"));
+include!(concat!(env!("OUT_DIR"), "/pack_info.rs"));
@@ -0,0 +1,50 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+impl Entry {
+    ///Returns a stable, URL-safe identifier for this entry, e.g. for linking to the entry on a
+    ///website. This is the sequence number ([Entry::number]), zero-padded to seven digits, e.g.
+    ///`"1002650"` for お母さん. Use [entry_by_permalink()] to find the entry again.
+    ///
+    ///The EDRDG keeps sequence numbers stable across JMdict releases: Existing entries keep their
+    ///number, and numbers of deleted entries are not reused. Note however that entries can be
+    ///merged or deleted, so a permalink may stop resolving after a JMdict update, and that an
+    ///entry may not be included in every build of this crate (see the `db-minimal` and `scope-*`
+    ///features).
+    pub fn permalink_id(&self) -> String {
+        format!("{:07}", self.number)
+    }
+}
+
+///Finds the entry with the given [permalink ID](Entry::permalink_id()). Returns `None` if the
+///input is not a permalink ID, or if no such entry is included in this build.
+///
+///```
+///let entry = jmdict::entries().next().unwrap();
+///let found = jmdict::entry_by_permalink(&entry.permalink_id()).unwrap();
+///assert_eq!(found.number, entry.number);
+///```
+pub fn entry_by_permalink(id: &str) -> Option<Entry> {
+    if id.is_empty() || !id.bytes().all(|b| b.is_ascii_digit()) {
+        return None;
+    }
+    let number: u32 = id.parse().ok()?;
+
+    //entries are ordered by sequence number, so we can do a binary search
+    let (mut lower, mut upper) = (0, payload::entry_count());
+    while lower < upper {
+        let mid = (lower + upper) / 2;
+        let entry = payload::get_entry(mid);
+        match entry.number.cmp(&number) {
+            std::cmp::Ordering::Equal => return Some(entry),
+            std::cmp::Ordering::Less => lower = mid + 1,
+            std::cmp::Ordering::Greater => upper = mid,
+        }
+    }
+    None
+}
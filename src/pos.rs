@@ -0,0 +1,179 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Coarse grammatical categories on top of the fine-grained [PartOfSpeech] values.
+//!
+//! The categories are matched on the JMdict codes instead of the enum variants, because some of
+//! the variants only exist with the `scope-archaic` feature.
+
+use crate::*;
+
+impl Sense {
+    ///Whether any part of speech of this sense is a verb. This covers all variants whose JMdict
+    ///code starts with `v`, plus [PartOfSpeech::AuxiliaryVerb] (`aux-v`):
+    ///
+    ///* [PartOfSpeech::UnspecifiedVerb] (`v-unspec`)
+    ///* the ichidan verbs: `IchidanVerb` (`v1`), `IchidanKureruVerb` (`v1-s`) and
+    ///  `IchidanZuruVerb` (`vz`)
+    ///* the godan verbs: `GodanAruVerb` (`v5aru`), `GodanBuVerb` (`v5b`) etc. up to
+    ///  `IrregularGodanUVerb` (`v5u-s`), as well as `IrregularGodanNuVerb` (`vn`) and
+    ///  `IrregularGodanRuVerbWithPlainRiForm` (`vr`)
+    ///* the archaic nidan verbs (`v2a-s` etc.) and yodan verbs (`v4b` etc.), if the
+    ///  `scope-archaic` feature is enabled
+    ///* `KuruVerb` (`vk`)
+    ///* the suru verbs: `SuruVerb` (`vs`), `SuruPrecursorVerb` (`vs-c`), `IncludedSuruVerb`
+    ///  (`vs-i`) and `SpecialSuruVerb` (`vs-s`)
+    ///* the transitivity markers `TransitiveVerb` (`vt`) and `IntransitiveVerb` (`vi`)
+    ///
+    ///Note that `vs` marks nouns that can be turned into a verb with する, so those senses usually
+    ///satisfy [Sense::is_noun()] as well.
+    pub fn is_verb(&self) -> bool {
+        self.has_pos_code(|code| code.starts_with('v') || code == "aux-v")
+    }
+
+    ///Whether any part of speech of this sense is a noun. This covers:
+    ///
+    ///* [PartOfSpeech::CommonNoun] (`n`)
+    ///* [PartOfSpeech::AdverbialNoun] (`n-adv`)
+    ///* [PartOfSpeech::ProperNoun] (`n-pr`)
+    ///* [PartOfSpeech::NounPrefix] (`n-pref`)
+    ///* [PartOfSpeech::NounSuffix] (`n-suf`)
+    ///* [PartOfSpeech::TemporalNoun] (`n-t`)
+    ///* [PartOfSpeech::Pronoun] (`pn`)
+    ///
+    ///Numerics (`num`) and counters (`ctr`) are not included.
+    pub fn is_noun(&self) -> bool {
+        self.has_pos_code(|code| code == "n" || code.starts_with("n-") || code == "pn")
+    }
+
+    ///Whether any part of speech of this sense is an adjective. This covers all variants whose
+    ///JMdict code starts with `adj-`, plus [PartOfSpeech::AuxiliaryAdjective] (`aux-adj`):
+    ///
+    ///* [PartOfSpeech::Adjective] (`adj-i`) and [PartOfSpeech::YoiAdjective] (`adj-ix`)
+    ///* [PartOfSpeech::AdjectivalNoun] (`adj-na`)
+    ///* [PartOfSpeech::NoAdjective] (`adj-no`)
+    ///* [PartOfSpeech::PreNounAdjectival] (`adj-pn`)
+    ///* [PartOfSpeech::TaruAdjective] (`adj-t`)
+    ///* [PartOfSpeech::NounOrVerbActingPrenominally] (`adj-f`)
+    ///* the archaic `KariAdjective` (`adj-kari`), `KuAdjective` (`adj-ku`), `NariAdjective`
+    ///  (`adj-nari`) and `ShikuAdjective` (`adj-shiku`), if the `scope-archaic` feature is
+    ///  enabled
+    pub fn is_adjective(&self) -> bool {
+        self.has_pos_code(|code| code.starts_with("adj-") || code == "aux-adj")
+    }
+
+    ///Whether any part of speech of this sense is an adverb. This covers:
+    ///
+    ///* [PartOfSpeech::Adverb] (`adv`)
+    ///* [PartOfSpeech::AdverbTakingToParticle] (`adv-to`)
+    ///* [PartOfSpeech::AdverbialNoun] (`n-adv`), which also counts as a noun
+    pub fn is_adverb(&self) -> bool {
+        self.has_pos_code(|code| matches!(code, "adv" | "adv-to" | "n-adv"))
+    }
+
+    ///Whether this sense is marked as an expression, i.e. a phrase or clause
+    ///([PartOfSpeech::Expression], `exp`).
+    pub fn is_expression(&self) -> bool {
+        self.has_pos_code(|code| code == "exp")
+    }
+
+    fn has_pos_code<F: Fn(&str) -> bool>(&self, predicate: F) -> bool {
+        self.parts_of_speech().any(|p| predicate(p.code()))
+    }
+}
+
+///The transitivity of a verb, as reported by [Entry::transitivity()].
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+pub enum Transitivity {
+    ///All senses with a transitivity marker are marked as [PartOfSpeech::TransitiveVerb] (`vt`).
+    Transitive,
+    ///All senses with a transitivity marker are marked as [PartOfSpeech::IntransitiveVerb] (`vi`).
+    Intransitive,
+    ///Some senses are transitive and some are intransitive (or a single sense is marked as both),
+    ///e.g. for 開く (ひらく).
+    Both,
+    ///No sense has a transitivity marker. This is the case for all entries that are not verbs,
+    ///but also for some verbs.
+    Unknown,
+}
+
+impl Entry {
+    ///Returns the transitivity of this entry, as derived from the [PartOfSpeech::TransitiveVerb]
+    ///(`vt`) and [PartOfSpeech::IntransitiveVerb] (`vi`) markers on its senses.
+    pub fn transitivity(&self) -> Transitivity {
+        let has_code = |code| self.senses().any(|s| s.has_pos_code(|c| c == code));
+        transitivity_from(has_code("vt"), has_code("vi"))
+    }
+
+    ///Finds the transitive counterpart of an intransitive verb, or vice versa, e.g. 開く (あく)
+    ///for 開ける (あける), or 閉める (しめる) for 閉まる (しまる). Returns `None` if no
+    ///counterpart was found.
+    ///
+    ///Many common verbs have some senses of the opposite transitivity (e.g. 開ける is
+    ///intransitive in 夜が明ける), so [Entry::transitivity()] reports [Transitivity::Both] for
+    ///them. This method therefore only looks at the first sense with a transitivity marker, which
+    ///reflects the main usage of the word. If that sense is both transitive and intransitive, as
+    ///for 開く (ひらく), there is no counterpart.
+    ///
+    ///Candidates are the entries with the opposite transitivity in their first marked sense whose
+    ///[primary kanji element](Entry::primary_kanji) starts with the same kanji as this entry's,
+    ///with the same reading for that kanji (as determined by [Entry::reading_with_okurigana()]).
+    ///If a cross-reference of this entry points to one of the candidates, that candidate is
+    ///returned. Otherwise, the first candidate in the order of [entries()] is returned.
+    ///
+    ///This is a heuristic that performs a linear scan over all entries. For entries that only
+    ///differ in okurigana, the result is usually correct, but pairs with a different stem
+    ///(e.g. 出る and 出す) are not found.
+    pub fn transitivity_pair(&self) -> Option<Entry> {
+        let wanted = match main_transitivity(self) {
+            Transitivity::Transitive => Transitivity::Intransitive,
+            Transitivity::Intransitive => Transitivity::Transitive,
+            _ => return None,
+        };
+        let stem = leading_kanji_span(self)?;
+        let candidates: Vec<Entry> = entries()
+            .filter(|e| e.number != self.number)
+            .filter(|e| main_transitivity(e) == wanted)
+            .filter(|e| leading_kanji_span(e) == Some(stem))
+            .collect();
+
+        let referenced = self
+            .senses()
+            .flat_map(|s| s.cross_references())
+            .map(CrossReference::parse)
+            .find_map(|xref| candidates.iter().find(|e| xref.matches(e)).copied());
+        referenced.or_else(|| candidates.first().copied())
+    }
+}
+
+fn transitivity_from(is_transitive: bool, is_intransitive: bool) -> Transitivity {
+    match (is_transitive, is_intransitive) {
+        (true, true) => Transitivity::Both,
+        (true, false) => Transitivity::Transitive,
+        (false, true) => Transitivity::Intransitive,
+        (false, false) => Transitivity::Unknown,
+    }
+}
+
+//Returns the transitivity of the first sense of the entry that has a transitivity marker.
+fn main_transitivity(entry: &Entry) -> Transitivity {
+    entry
+        .senses()
+        .map(|s| transitivity_from(s.has_pos_code(|c| c == "vt"), s.has_pos_code(|c| c == "vi")))
+        .find(|&t| t != Transitivity::Unknown)
+        .unwrap_or(Transitivity::Unknown)
+}
+
+//Returns the first kanji run of the entry's primary kanji element together with its reading, but
+//only if it is followed by okurigana (like 開 and あ in 開ける).
+fn leading_kanji_span(entry: &Entry) -> Option<(&'static str, &'static str)> {
+    match entry.reading_with_okurigana().as_slice() {
+        [ReadingSpan::Kanji { text, reading }, ReadingSpan::Kana { .. }, ..] => {
+            Some((text, reading))
+        }
+        _ => None,
+    }
+}
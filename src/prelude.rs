@@ -0,0 +1,29 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Re-exports of the most commonly used types and functions, for use with a glob import:
+//!
+//! ```
+//! use jmdict::prelude::*;
+//!
+//! let entry: Entry = entries().find(|e| e.number == 1002650).unwrap();
+//! let reading: ReadingElement = entry.reading_elements().next().unwrap();
+//! assert_eq!(reading.text, "おかあさん");
+//! ```
+//!
+//! All of these are also available at their regular paths in the crate root. The [Enum] trait is
+//! included so that methods like `code()` can be called on the enum types.
+
+pub use crate::{
+    entries, entry_by_permalink, search_anywhere, suggest_readings, CrossReference, Dialect, Entry,
+    Enum, Gloss, GlossLanguage, GlossType, KanjiElement, KanjiInfo, PartOfSpeech, Priority, Query,
+    ReadingElement, ReadingInfo, Sense, SenseInfo, SenseTopic,
+};
+
+#[cfg(feature = "index-frequency")]
+pub use crate::entries_by_frequency;
+#[cfg(feature = "index-kanji")]
+pub use crate::entries_containing_kanji;
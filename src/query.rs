@@ -0,0 +1,212 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+///A set of filters that can be applied to the entries in the database. Queries are constructed
+///with the builder methods on this type, and evaluated by calling [Query::entries()]:
+///
+///```
+///let query = jmdict::Query::new().modern_only();
+///let count = query.entries().count();
+///assert!(count <= jmdict::entries().count());
+///```
+#[derive(Clone, Debug, Default)]
+pub struct Query {
+    modern_only: bool,
+    has_frequency_rank: bool,
+    pos_all: Vec<PartOfSpeech>,
+    pos_any: Vec<Vec<PartOfSpeech>>,
+    exclude_misc: Vec<SenseInfo>,
+    require_misc: Vec<Vec<SenseInfo>>,
+}
+
+impl Query {
+    ///Creates a query that matches all entries.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    ///Excludes entries where all senses are archaic, obsolete or rare, as reported by
+    ///[Sense::is_archaic_or_rare()]. Entries with at least one sense in current use are kept,
+    ///including their archaic senses.
+    pub fn modern_only(mut self) -> Self {
+        self.modern_only = true;
+        self
+    }
+
+    ///Only keeps entries with a kanji element or reading element that has a frequency rank from
+    ///the wordfreq file, i.e. where [Priority::frequency_bucket] is not zero. This is useful for
+    ///features that sort or grade words by frequency.
+    pub fn has_frequency_rank(mut self) -> Self {
+        self.has_frequency_rank = true;
+        self
+    }
+
+    ///Only keeps entries with a [Sense] that has all of the given parts of speech. For example,
+    ///`pos_all(&[PartOfSpeech::IchidanVerb, PartOfSpeech::TransitiveVerb])` finds transitive
+    ///ichidan verbs. Calling this several times is the same as calling it once with all parts of
+    ///speech combined.
+    ///
+    ///All part-of-speech filters are evaluated per sense: An entry only matches if a single
+    ///sense satisfies all [Query::pos_all()] and [Query::pos_any()] filters at once. An entry
+    ///where one sense is transitive and another sense is intransitive therefore matches
+    ///`pos_any(&[TransitiveVerb])` and `pos_any(&[IntransitiveVerb])`, but not
+    ///`pos_all(&[TransitiveVerb, IntransitiveVerb])`.
+    pub fn pos_all(mut self, pos: &[PartOfSpeech]) -> Self {
+        self.pos_all.extend_from_slice(pos);
+        self
+    }
+
+    ///Only keeps entries with a [Sense] that has at least one of the given parts of speech. When
+    ///called several times, each call adds a separate condition, and the same sense needs to
+    ///satisfy all of them. See [Query::pos_all()] for details. If `pos` is empty, no entries
+    ///match.
+    pub fn pos_any(mut self, pos: &[PartOfSpeech]) -> Self {
+        self.pos_any.push(pos.to_vec());
+        self
+    }
+
+    ///Only keeps entries with a [Sense] that has none of the given [SenseInfo] markers. For
+    ///example, a deck for use in the classroom could use
+    ///`exclude_misc(&[SenseInfo::VulgarTerm, SenseInfo::XRated, SenseInfo::Slang])`. Calling this
+    ///several times is the same as calling it once with all markers combined.
+    ///
+    ///Like the part-of-speech filters, this is evaluated per sense, together with all other
+    ///sense-level filters (see [Query::matches_sense()]). An entry with one vulgar sense and one
+    ///neutral sense therefore still matches, and **the vulgar sense is still included in the
+    ///entry**. To hide it, filter the senses of each result with [Query::matches_sense()]. Only
+    ///entries where every sense is excluded are dropped.
+    pub fn exclude_misc(mut self, infos: &[SenseInfo]) -> Self {
+        self.exclude_misc.extend_from_slice(infos);
+        self
+    }
+
+    ///Only keeps entries with a [Sense] that has at least one of the given [SenseInfo] markers,
+    ///e.g. `require_misc(&[SenseInfo::Slang, SenseInfo::InternetSlang])`. When called several
+    ///times, each call adds a separate condition, and the same sense needs to satisfy all of them
+    ///(as well as all other sense-level filters, see [Query::matches_sense()]). If `infos` is
+    ///empty, no entries match.
+    pub fn require_misc(mut self, infos: &[SenseInfo]) -> Self {
+        self.require_misc.push(infos.to_vec());
+        self
+    }
+
+    ///Whether the given entry satisfies all filters of this query.
+    pub fn matches(&self, entry: &Entry) -> bool {
+        if self.modern_only && entry.senses().all(|s| s.is_archaic_or_rare()) {
+            return false;
+        }
+        if self.has_frequency_rank {
+            let ke_pris = entry.kanji_elements().map(|k| k.priority);
+            let re_pris = entry.reading_elements().map(|r| r.priority);
+            if !ke_pris.chain(re_pris).any(|p| p.frequency_bucket > 0) {
+                return false;
+            }
+        }
+        if self.has_sense_filters() {
+            return entry.senses().any(|s| self.matches_sense(&s));
+        }
+        true
+    }
+
+    ///Whether the given sense satisfies all sense-level filters of this query, i.e. those from
+    ///[Query::pos_all()], [Query::pos_any()], [Query::exclude_misc()] and
+    ///[Query::require_misc()]. An entry matches the query if at least one of its senses does, so
+    ///this can be used to hide the other senses when displaying the results:
+    ///
+    ///```
+    ///# use jmdict::{Query, SenseInfo};
+    ///let query = Query::new().exclude_misc(&[SenseInfo::VulgarTerm]);
+    ///for entry in query.entries().take(10) {
+    ///    let senses: Vec<_> = entry.senses().filter(|s| query.matches_sense(s)).collect();
+    ///    assert!(!senses.is_empty());
+    ///}
+    ///```
+    pub fn matches_sense(&self, sense: &Sense) -> bool {
+        let has_pos = |pos: &PartOfSpeech| sense.parts_of_speech().any(|p| p == *pos);
+        let has_info = |info: &SenseInfo| sense.infos().any(|i| i == *info);
+        self.pos_all.iter().all(has_pos)
+            && self.pos_any.iter().all(|group| group.iter().any(has_pos))
+            && !self.exclude_misc.iter().any(has_info)
+            && self
+                .require_misc
+                .iter()
+                .all(|group| group.iter().any(has_info))
+    }
+
+    fn has_sense_filters(&self) -> bool {
+        !self.pos_all.is_empty()
+            || !self.pos_any.is_empty()
+            || !self.exclude_misc.is_empty()
+            || !self.require_misc.is_empty()
+    }
+
+    ///Returns an iterator over all entries in the database that match this query.
+    pub fn entries(&self) -> QueryResults {
+        QueryResults {
+            query: self.clone(),
+            entries: entries(),
+        }
+    }
+}
+
+///An iterator over the entries matching a [Query]. This is returned by [Query::entries()].
+#[derive(Clone)]
+pub struct QueryResults {
+    query: Query,
+    entries: Entries,
+}
+
+impl std::iter::Iterator for QueryResults {
+    type Item = Entry;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let query = &self.query;
+        self.entries.find(|e| query.matches(e))
+    }
+
+    fn size_hint(&self) -> (usize, Option<usize>) {
+        (0, self.entries.size_hint().1)
+    }
+}
+
+///Returns an iterator over all entries that are not entirely archaic, obsolete or rare. This is
+///a shorthand for `Query::new().modern_only().entries()`.
+pub fn modern_entries() -> QueryResults {
+    Query::new().modern_only().entries()
+}
+
+///Returns all entries where the given text appears as a substring of any kanji element, reading
+///element or gloss (in any of the compiled languages). Entries are reported once each, in the same
+///order as in [entries()]. The comparison is case-sensitive and does not normalize kana.
+///
+///This is a catch-all for debugging and power searches. It performs a linear scan over all
+///entries, so prefer more targeted lookups where possible.
+///
+///```
+///let entry = jmdict::search_anywhere("母さ").find(|e| e.number == 1002650);
+///assert!(entry.is_some());
+///```
+pub fn search_anywhere(query: &str) -> impl Iterator<Item = Entry> {
+    let query = query.to_owned();
+    entries().filter(move |e| {
+        e.all_forms().any(|text| text.contains(&query))
+            || e.senses()
+                .any(|s| s.glosses().any(|g| g.text.contains(&query)))
+    })
+}
+
+///Returns an iterator over all entries with a reading of exactly `count` morae, as counted by
+///[ReadingElement::mora_count()]. This is intended for tools that deal with rhythm, e.g. for
+///counting syllables in haiku. Search-only readings (see [ReadingElement::is_search_only()]) are
+///not considered.
+pub fn entries_with_mora_count(count: usize) -> impl Iterator<Item = Entry> {
+    entries().filter(move |e| {
+        e.reading_elements()
+            .any(|r| !r.is_search_only() && r.mora_count() == count)
+    })
+}
@@ -0,0 +1,264 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Conversion of kana into the Latin script.
+
+use crate::*;
+
+///A system for writing Japanese in the Latin script, for use with [kana_to_romaji()].
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+pub enum RomajiStyle {
+    ///Hepburn romanization, which follows English pronunciation: し → shi, ち → chi, つ → tsu,
+    ///ふ → fu, じ and ぢ → ji, しゃ → sha, を → o. This is the most widely known system.
+    Hepburn,
+    ///Kunrei-shiki romanization, as standardized by the Japanese government: し → si, ち → ti,
+    ///つ → tu, ふ → hu, じ and ぢ → zi, しゃ → sya, を → o.
+    Kunrei,
+    ///Nihon-shiki romanization, which is like Kunrei-shiki, but keeps distinct spellings for
+    ///kana that are pronounced the same: ぢ → di, づ → du, を → wo, ゐ → wi, ゑ → we.
+    NihonShiki,
+}
+
+impl Default for RomajiStyle {
+    fn default() -> Self {
+        Self::Hepburn
+    }
+}
+
+impl ReadingElement {
+    ///Converts the text of this reading element into romaji. See [kana_to_romaji()] for details.
+    pub fn to_romaji(&self, style: RomajiStyle) -> String {
+        kana_to_romaji(self.text, style)
+    }
+}
+
+///Converts hiragana and katakana into romaji in the given style. Characters other than kana are
+///copied into the output unchanged.
+///
+///```
+///use jmdict::{kana_to_romaji, RomajiStyle::*};
+///assert_eq!(kana_to_romaji("しんぶん", Hepburn), "shinbun");
+///assert_eq!(kana_to_romaji("ちゃっつ", Hepburn), "chattsu");
+///assert_eq!(kana_to_romaji("ちゃっつ", Kunrei), "tyattu");
+///assert_eq!(kana_to_romaji("きんえん", Hepburn), "kin'en");
+///assert_eq!(kana_to_romaji("ラーメン", Hepburn), "raamen");
+///```
+///
+///This is a purely mechanical transliteration. Long vowels are written out instead of using
+///macrons or circumflexes (e.g. とうきょう → toukyou, ラーメン → raamen), ん is always written as
+///`n` (with an apostrophe if a vowel or `y` follows), and particles are not recognized (e.g. は
+///is always `ha`). A sokuon (っ) that is not followed by a consonant is dropped.
+pub fn kana_to_romaji(text: &str, style: RomajiStyle) -> String {
+    let chars: Vec<char> = text.chars().map(kana::to_hiragana).collect();
+    let mut out = String::new();
+    let mut sokuon = false;
+    let mut idx = 0;
+    while idx < chars.len() {
+        let c = chars[idx];
+        let next = chars.get(idx + 1).copied();
+
+        //ん and the special characters that depend on the surrounding syllables
+        match c {
+            'っ' => {
+                sokuon = true;
+                idx += 1;
+                continue;
+            }
+            'ん' => {
+                out.push('n');
+                let next_romaji = next.and_then(|n| syllable(n, style));
+                if let Some(s) = next_romaji {
+                    if s.starts_with(|c| "aiueoy".contains(c)) {
+                        out.push('\'');
+                    }
+                }
+                idx += 1;
+                continue;
+            }
+            'ー' => {
+                if let Some(vowel) = out.chars().last().filter(|c| "aiueo".contains(*c)) {
+                    out.push(vowel);
+                }
+                idx += 1;
+                continue;
+            }
+            _ => {}
+        }
+
+        //try to combine with a following small kana into a single syllable (e.g. しゃ, ふぁ)
+        let (romaji, consumed) = match next.and_then(|n| digraph(c, n, style)) {
+            Some(s) => (Some(s), 2),
+            None => (syllable(c, style).map(String::from), 1),
+        };
+        match romaji {
+            Some(s) => {
+                if sokuon {
+                    if s.starts_with("ch") {
+                        out.push('t');
+                    } else if let Some(first) = s.chars().next().filter(|c| !"aiueo".contains(*c)) {
+                        out.push(first);
+                    }
+                }
+                out.push_str(&s);
+            }
+            None => out.push(chars[idx]),
+        }
+        sokuon = false;
+        idx += consumed;
+    }
+    out
+}
+
+//Returns the romaji for a single kana (after conversion to hiragana).
+fn syllable(c: char, style: RomajiStyle) -> Option<&'static str> {
+    use RomajiStyle::*;
+    let (hepburn, kunrei, nihon) = match c {
+        'し' => ("shi", "si", "si"),
+        'じ' => ("ji", "zi", "zi"),
+        'ち' => ("chi", "ti", "ti"),
+        'ぢ' => ("ji", "zi", "di"),
+        'つ' => ("tsu", "tu", "tu"),
+        'づ' => ("zu", "zu", "du"),
+        'ふ' => ("fu", "hu", "hu"),
+        'ゐ' => ("i", "i", "wi"),
+        'ゑ' => ("e", "e", "we"),
+        'を' => ("o", "o", "wo"),
+        _ => {
+            let s = common_syllable(c)?;
+            (s, s, s)
+        }
+    };
+    Some(match style {
+        Hepburn => hepburn,
+        Kunrei => kunrei,
+        NihonShiki => nihon,
+    })
+}
+
+//Returns the romaji for the kana that are written the same in all styles.
+fn common_syllable(c: char) -> Option<&'static str> {
+    Some(match c {
+        'あ' | 'ぁ' => "a",
+        'い' | 'ぃ' => "i",
+        'う' | 'ぅ' => "u",
+        'え' | 'ぇ' => "e",
+        'お' | 'ぉ' => "o",
+        'か' | 'ゕ' => "ka",
+        'き' => "ki",
+        'く' => "ku",
+        'け' | 'ゖ' => "ke",
+        'こ' => "ko",
+        'が' => "ga",
+        'ぎ' => "gi",
+        'ぐ' => "gu",
+        'げ' => "ge",
+        'ご' => "go",
+        'さ' => "sa",
+        'す' => "su",
+        'せ' => "se",
+        'そ' => "so",
+        'ざ' => "za",
+        'ず' => "zu",
+        'ぜ' => "ze",
+        'ぞ' => "zo",
+        'た' => "ta",
+        'て' => "te",
+        'と' => "to",
+        'だ' => "da",
+        'で' => "de",
+        'ど' => "do",
+        'な' => "na",
+        'に' => "ni",
+        'ぬ' => "nu",
+        'ね' => "ne",
+        'の' => "no",
+        'は' => "ha",
+        'ひ' => "hi",
+        'へ' => "he",
+        'ほ' => "ho",
+        'ば' => "ba",
+        'び' => "bi",
+        'ぶ' => "bu",
+        'べ' => "be",
+        'ぼ' => "bo",
+        'ぱ' => "pa",
+        'ぴ' => "pi",
+        'ぷ' => "pu",
+        'ぺ' => "pe",
+        'ぽ' => "po",
+        'ま' => "ma",
+        'み' => "mi",
+        'む' => "mu",
+        'め' => "me",
+        'も' => "mo",
+        'や' | 'ゃ' => "ya",
+        'ゆ' | 'ゅ' => "yu",
+        'よ' | 'ょ' => "yo",
+        'ら' => "ra",
+        'り' => "ri",
+        'る' => "ru",
+        'れ' => "re",
+        'ろ' => "ro",
+        'わ' | 'ゎ' => "wa",
+        'ゔ' => "vu",
+        'ヷ' => "va",
+        'ヸ' => "vi",
+        'ヹ' => "ve",
+        'ヺ' => "vo",
+        _ => return None,
+    })
+}
+
+//Returns the romaji for a kana followed by a small kana, e.g. しゃ or ふぁ, or None if the two
+//kana do not form a single syllable.
+fn digraph(c: char, small: char, style: RomajiStyle) -> Option<String> {
+    //palatalized syllables: き + ゃ → kya (or sha/sya for し etc.)
+    if let Some(vowel) = match small {
+        'ゃ' => Some('a'),
+        'ゅ' => Some('u'),
+        'ょ' => Some('o'),
+        _ => None,
+    } {
+        let base = syllable(c, style).filter(|s| s.len() > 1 && s.ends_with('i'))?;
+        let stem = &base[..(base.len() - 1)];
+        let hepburn_stem = matches!(stem, "sh" | "ch" | "j");
+        return Some(if style == RomajiStyle::Hepburn && hepburn_stem {
+            format!("{}{}", stem, vowel)
+        } else {
+            format!("{}y{}", stem, vowel)
+        });
+    }
+
+    //extended katakana for loanwords, e.g. ファ → fa, ティ → ti, シェ → she
+    let vowel = match small {
+        'ぁ' => 'a',
+        'ぃ' => 'i',
+        'ぅ' => 'u',
+        'ぇ' => 'e',
+        'ぉ' => 'o',
+        _ => return None,
+    };
+    let stem = match (c, vowel) {
+        ('ふ', _) => "f",
+        ('ゔ', _) => "v",
+        ('う', 'i') | ('う', 'e') | ('う', 'o') => "w",
+        ('て', 'i') | ('と', 'u') => "t",
+        ('で', 'i') | ('ど', 'u') => "d",
+        ('し', 'e') => return Some(palatalized("sh", "sy", 'e', style)),
+        ('じ', 'e') => return Some(palatalized("j", "zy", 'e', style)),
+        ('ち', 'e') => return Some(palatalized("ch", "ty", 'e', style)),
+        _ => return None,
+    };
+    Some(format!("{}{}", stem, vowel))
+}
+
+fn palatalized(hepburn_stem: &str, other_stem: &str, vowel: char, style: RomajiStyle) -> String {
+    let stem = match style {
+        RomajiStyle::Hepburn => hepburn_stem,
+        _ => other_stem,
+    };
+    format!("{}{}", stem, vowel)
+}
@@ -0,0 +1,43 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+//! Entry counts, e.g. for displaying statistics about the database.
+
+use crate::*;
+
+///Counts the entries that satisfy the given predicate. This is the same as
+///`entries().filter(pred).count()`, but does not require the predicate to take ownership.
+///
+///Since [Entry] is only a handle into the embedded payload, and kanji elements, readings and
+///senses are only decoded when they are accessed, this is about as fast as the predicate allows.
+///For the most common questions, [entry_count()], [common_entry_count()] and
+///[entry_count_for_language()] do not need to look at any entries at all.
+///
+///```
+///let verbs = jmdict::count_where(|e| e.senses().any(|s| s.is_verb()));
+///assert!(verbs <= jmdict::entry_count());
+///```
+pub fn count_where<P: Fn(&Entry) -> bool>(pred: P) -> usize {
+    entries().filter(|e| pred(e)).count()
+}
+
+///Returns the number of entries in the database. This is the same as `entries().count()`.
+pub fn entry_count() -> usize {
+    payload::entry_count()
+}
+
+///Returns the number of entries with at least one kanji element or reading element that is marked
+///as [common](Priority::is_common()). This is precomputed at build time.
+pub fn common_entry_count() -> usize {
+    payload::COMMON_ENTRY_COUNT
+}
+
+///Returns the number of entries with glosses in the given language, i.e. those where
+///[Entry::has_gloss_language()] is true. This is precomputed at build time.
+pub fn entry_count_for_language(lang: GlossLanguage) -> usize {
+    let idx = jmdict_enums::EnumPayload::to_u32(&lang);
+    payload::LANGUAGE_ENTRY_COUNTS[idx as usize]
+}
@@ -0,0 +1,137 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+///Returns up to `limit` readings from the database that are closest to the given query, together
+///with the entries they belong to. This is intended as a "did you mean" fallback when a lookup by
+///reading does not find anything.
+///
+///Closeness is measured as an edit distance over kana, where hiragana and katakana are
+///interchangeable, and where confusing a kana with its voiced or small variant (e.g. か/が, は/ぱ
+///or つ/っ) only counts as half an edit. Queries of up to three characters allow one edit, longer
+///queries allow two. Results are ordered by distance first, then by reading and entry number.
+///
+///This performs a linear scan over all reading elements, but each comparison is cheap, so it is
+///fast enough for interactive use.
+pub fn suggest_readings(query: &str, limit: usize) -> Vec<(&'static str, Entry)> {
+    let query: Vec<char> = query.chars().map(kana::to_hiragana).collect();
+    let max_cost = if query.len() <= 3 { 2 } else { 4 };
+
+    let mut candidates = Vec::new();
+    let mut buf = Vec::new();
+    for entry in entries() {
+        for reading in entry.reading_elements() {
+            buf.clear();
+            buf.extend(reading.text.chars().map(kana::to_hiragana));
+            if let Some(cost) = bounded_distance(&query, &buf, max_cost) {
+                candidates.push((cost, reading.text, entry));
+            }
+        }
+    }
+
+    candidates.sort_by(|a, b| (a.0, a.1, a.2.number).cmp(&(b.0, b.1, b.2.number)));
+    candidates
+        .into_iter()
+        .take(limit)
+        .map(|(_, text, entry)| (text, entry))
+        .collect()
+}
+
+///Computes the edit distance between `a` and `b` in units of half an edit (see
+///[suggest_readings()]), or returns `None` if it exceeds `max_cost`.
+pub(crate) fn bounded_distance(a: &[char], b: &[char], max_cost: usize) -> Option<usize> {
+    let len_diff = if a.len() > b.len() {
+        a.len() - b.len()
+    } else {
+        b.len() - a.len()
+    };
+    if len_diff * 2 > max_cost {
+        return None;
+    }
+
+    //classic dynamic programming over two rows, with an early exit when an entire row exceeds the
+    //bound
+    let mut prev: Vec<usize> = (0..=b.len()).map(|j| j * 2).collect();
+    let mut current = vec![0; b.len() + 1];
+    for (i, &ca) in a.iter().enumerate() {
+        current[0] = (i + 1) * 2;
+        for (j, &cb) in b.iter().enumerate() {
+            let substitution = prev[j] + substitution_cost(ca, cb);
+            let deletion = prev[j + 1] + 2;
+            let insertion = current[j] + 2;
+            current[j + 1] = substitution.min(deletion).min(insertion);
+        }
+        if current.iter().all(|&cost| cost > max_cost) {
+            return None;
+        }
+        std::mem::swap(&mut prev, &mut current);
+    }
+
+    let cost = prev[b.len()];
+    if cost <= max_cost {
+        Some(cost)
+    } else {
+        None
+    }
+}
+
+fn substitution_cost(a: char, b: char) -> usize {
+    if a == b {
+        0
+    } else if base_kana(a) == base_kana(b) {
+        1
+    } else {
+        2
+    }
+}
+
+///Maps voiced, semi-voiced and small hiragana to their plain counterpart.
+fn base_kana(c: char) -> char {
+    BASE_KANA
+        .iter()
+        .find(|(variant, _)| *variant == c)
+        .map_or(c, |(_, base)| *base)
+}
+
+static BASE_KANA: &[(char, char)] = &[
+    ('が', 'か'),
+    ('ぎ', 'き'),
+    ('ぐ', 'く'),
+    ('げ', 'け'),
+    ('ご', 'こ'),
+    ('ざ', 'さ'),
+    ('じ', 'し'),
+    ('ず', 'す'),
+    ('ぜ', 'せ'),
+    ('ぞ', 'そ'),
+    ('だ', 'た'),
+    ('ぢ', 'ち'),
+    ('づ', 'つ'),
+    ('で', 'て'),
+    ('ど', 'と'),
+    ('ば', 'は'),
+    ('び', 'ひ'),
+    ('ぶ', 'ふ'),
+    ('べ', 'へ'),
+    ('ぼ', 'ほ'),
+    ('ぱ', 'は'),
+    ('ぴ', 'ひ'),
+    ('ぷ', 'ふ'),
+    ('ぺ', 'へ'),
+    ('ぽ', 'ほ'),
+    ('ぁ', 'あ'),
+    ('ぃ', 'い'),
+    ('ぅ', 'う'),
+    ('ぇ', 'え'),
+    ('ぉ', 'お'),
+    ('っ', 'つ'),
+    ('ゃ', 'や'),
+    ('ゅ', 'ゆ'),
+    ('ょ', 'よ'),
+    ('ゎ', 'わ'),
+    ('ゔ', 'う'),
+];
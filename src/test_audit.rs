@@ -0,0 +1,29 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_find_okurigana_variants() {
+    let pairs = find_okurigana_variants();
+    let hiragana = |r: ReadingElement| r.text.chars().map(kana::to_hiragana).collect::<String>();
+    for (a, b) in &pairs {
+        assert!(a.number < b.number);
+        //there must be a shared reading
+        assert!(a
+            .reading_elements()
+            .any(|ra| b.reading_elements().any(|rb| hiragana(ra) == hiragana(rb))));
+    }
+
+    //画 (かく) and 描く/画く (かく); may be skipped if the entries or the kanji element 画く are not
+    //available
+    let numbers: Vec<_> = pairs.iter().map(|(a, b)| (a.number, b.number)).collect();
+    let has_kanji =
+        |n, text| entries().any(|e| e.number == n && e.kanji_elements().any(|k| k.text == text));
+    if has_kanji(1197050, "画") && has_kanji(1583460, "画く") {
+        assert!(numbers.contains(&(1197050, 1583460)));
+    }
+}
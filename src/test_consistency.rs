@@ -6,6 +6,17 @@
 
 use std::fmt::Debug;
 
+//Options for the tests below. If `is_full`, all entries are visited regardless of the selected
+//features, e.g. for tests that bring their own entrypack.
+fn test_options(is_full: bool) -> jmdict_traverse::Options {
+    jmdict_traverse::Options {
+        is_db_minimal: !is_full && cfg!(feature = "db-minimal"),
+        with_uncommon: is_full || cfg!(feature = "scope-uncommon"),
+        with_archaic: is_full || cfg!(feature = "scope-archaic"),
+        on_error: jmdict_traverse::ErrorPolicy::Fail,
+    }
+}
+
 #[test]
 fn check_consistency() {
     //This test runs through the data files in the repository a second time and checks that
@@ -22,17 +33,244 @@ fn check_consistency() {
         }
     }
 
-    let opts = jmdict_traverse::Options {
-        is_db_minimal: cfg!(feature = "db-minimal"),
-        with_uncommon: cfg!(feature = "scope-uncommon"),
-        with_archaic: cfg!(feature = "scope-archaic"),
-    };
+    let opts = test_options(false);
 
     let mut v = Visitor(crate::entries());
-    jmdict_traverse::process_dictionary(&mut v, opts);
+    jmdict_traverse::process_dictionary(&mut v, opts).unwrap();
     assert!(v.0.next().is_none(), "not all entries were exhausted");
 }
 
+#[test]
+fn check_stream_entries() {
+    //stream_entries() reads the same data as process_dictionary(), but only works on the plain
+    //entrypack from the repository
+    if std::env::var_os("RUST_JMDICT_ENTRYPACK").is_some() {
+        return;
+    }
+    let file = match std::fs::File::open("data/entrypack.json") {
+        Ok(file) => file,
+        Err(_) => return,
+    };
+
+    let opts = test_options(false);
+    let mut expected = crate::entries();
+    let mut count = 0;
+    let reader = std::io::BufReader::new(file);
+    jmdict_traverse::stream_entries(
+        reader,
+        &opts,
+        |entry| {
+            entry.check(&expected.next().unwrap());
+            count += 1;
+            if count == 100 {
+                std::ops::ControlFlow::Break(())
+            } else {
+                std::ops::ControlFlow::Continue(())
+            }
+        },
+        |_| {},
+    )
+    .unwrap();
+    assert_eq!(count, 100.min(crate::entries().count()));
+}
+
+#[test]
+fn check_pack_header() {
+    //a header line in front of the entries must not change which entries are reported
+    let contents = match std::fs::read_to_string("data/entrypack.json") {
+        Ok(contents) => contents,
+        Err(_) => return,
+    };
+    let lines: Vec<&str> = contents.lines().take(10).collect();
+    let without_header = format!("{}\n", lines.join("\n"));
+    let with_header = format!("{}\n{}", r#"{"v":1,"schema":["examples"]}"#, without_header);
+
+    let opts = test_options(false);
+    let stream_seqs = |input: &str| {
+        let mut seqs = Vec::new();
+        jmdict_traverse::stream_entries(
+            input.as_bytes(),
+            &opts,
+            |entry| {
+                seqs.push(entry.ent_seq);
+                std::ops::ControlFlow::Continue(())
+            },
+            |_| {},
+        )
+        .unwrap();
+        seqs
+    };
+    assert_eq!(stream_seqs(&with_header), stream_seqs(&without_header));
+}
+
+#[test]
+#[cfg(feature = "translations-eng")]
+fn check_skipped_entries() {
+    //with ErrorPolicy::Skip, stream_entries() reports malformed entries instead of failing
+    let input = concat!(
+        r#"{"n":1,"R":[{"t":"あ"}],"S":[{"G":[{"t":"test"}]}]}"#,
+        "\n",
+        r#"{"n":2,"R":["#,
+        "\n",
+        r#"{"n":3,"R":[],"S":[]}"#,
+        "\n",
+        r#"{"n":4,"R":[{"t":"え"}],"S":[{"G":[{"t":"test"}]}]}"#,
+        "\n",
+    );
+    let opts = jmdict_traverse::Options {
+        on_error: jmdict_traverse::ErrorPolicy::Skip,
+        ..test_options(true)
+    };
+    let mut seqs = Vec::new();
+    let mut skipped = Vec::new();
+    jmdict_traverse::stream_entries(
+        input.as_bytes(),
+        &opts,
+        |entry| {
+            seqs.push(entry.ent_seq);
+            std::ops::ControlFlow::Continue(())
+        },
+        |err| skipped.push(err.to_string()),
+    )
+    .unwrap();
+    assert_eq!(seqs, vec![1, 4]);
+    assert_eq!(skipped.len(), 2);
+    assert!(skipped[0].starts_with("entry on line 2 is not valid JSON"));
+    assert_eq!(skipped[1], "entry 3 does not have any reading elements");
+}
+
+#[test]
+#[cfg(feature = "translations-eng")]
+fn check_default_gloss_language() {
+    //glosses without a language and glosses with an explicit "eng" are both English
+    let input =
+        r#"{"n":1,"R":[{"t":"て"}],"S":[{"G":[{"t":"implicit"},{"t":"explicit","l":"eng"}]}]}"#;
+    let opts = test_options(true);
+    let mut glosses = Vec::new();
+    jmdict_traverse::stream_entries(
+        input.as_bytes(),
+        &opts,
+        |entry| {
+            for gloss in &entry.sense[0].gloss {
+                glosses.push((gloss.text.to_string(), gloss.lang));
+            }
+            std::ops::ControlFlow::Continue(())
+        },
+        |_| {},
+    )
+    .unwrap();
+    assert_eq!(
+        glosses,
+        vec![
+            ("implicit".to_string(), crate::GlossLanguage::English),
+            ("explicit".to_string(), crate::GlossLanguage::English),
+        ]
+    );
+}
+
+#[test]
+#[should_panic(expected = "unknown AllGlossLanguage representation: xyz")]
+fn check_unknown_gloss_language() {
+    //a new language in the JMdict must fail the build instead of losing glosses silently
+    let input = r#"{"n":1,"R":[{"t":"て"}],"S":[{"G":[{"t":"unknown","l":"xyz"}]}]}"#;
+    let opts = test_options(true);
+    let _ = jmdict_traverse::stream_entries(
+        input.as_bytes(),
+        &opts,
+        |_| std::ops::ControlFlow::Continue(()),
+        |_| {},
+    );
+}
+
+#[test]
+#[cfg(feature = "translations-eng")]
+fn check_pos_inheritance() {
+    //the second sense inherits from the first, but the German sense does not inherit from the
+    //English senses
+    let input = concat!(
+        r#"{"n":1,"R":[{"t":"あける"}],"S":["#,
+        r#"{"p":["v1","vt"],"G":[{"t":"to open"}]},"#,
+        r#"{"G":[{"t":"to unwrap"}]},"#,
+        r#"{"p":["n"],"G":[{"t":"opening"}]},"#,
+        r#"{"G":[{"t":"öffnen","l":"ger"}]}]}"#,
+    );
+    let opts = test_options(true);
+    let mut senses = Vec::new();
+    jmdict_traverse::stream_entries(
+        input.as_bytes(),
+        &opts,
+        |entry| {
+            for sense in &entry.sense {
+                senses.push((sense.gloss[0].text.to_string(), sense.pos.clone()));
+            }
+            std::ops::ControlFlow::Continue(())
+        },
+        |_| {},
+    )
+    .unwrap();
+
+    use crate::PartOfSpeech::*;
+    assert_eq!(senses[0].1, vec![IchidanVerb, TransitiveVerb]);
+    assert_eq!(senses[1].1, vec![IchidanVerb, TransitiveVerb]);
+    assert_eq!(senses[2].1, vec![CommonNoun]);
+    for (text, pos) in &senses[3..] {
+        assert_eq!(text, "öffnen");
+        assert!(pos.is_empty());
+    }
+}
+
+#[test]
+#[cfg(feature = "translations-eng")]
+fn check_pos_inheritance_with_disabled_pos() {
+    //v4r is only available with "scope-archaic"; without it, the second sense must not inherit v5r
+    //from the first sense just because its own parts of speech are not compiled in
+    let input = concat!(
+        r#"{"n":1,"R":[{"t":"やる"}],"S":["#,
+        r#"{"p":["v5r","vt"],"G":[{"t":"to do"}]},"#,
+        r#"{"p":["v4r"],"G":[{"t":"to do (archaic)"}]},"#,
+        r#"{"G":[{"t":"to give"}]}]}"#,
+    );
+    let opts = test_options(true);
+    let mut senses = Vec::new();
+    jmdict_traverse::stream_entries(
+        input.as_bytes(),
+        &opts,
+        |entry| {
+            senses.extend(entry.sense.iter().map(|s| s.pos.clone()));
+            std::ops::ControlFlow::Continue(())
+        },
+        |_| {},
+    )
+    .unwrap();
+
+    use crate::PartOfSpeech::*;
+    #[cfg(feature = "scope-archaic")]
+    let archaic = vec![YodanRuVerb];
+    #[cfg(not(feature = "scope-archaic"))]
+    let archaic: Vec<crate::PartOfSpeech> = vec![];
+    assert_eq!(senses[0], vec![GodanRuVerb, TransitiveVerb]);
+    assert_eq!(senses[1], archaic);
+    assert_eq!(senses[2], archaic);
+}
+
+#[test]
+fn check_pos_combinations() {
+    //observed_pos_combinations() is computed at build time, so check it against a full scan
+    let mut expected: Vec<Vec<crate::PartOfSpeech>> = Vec::new();
+    for entry in crate::entries() {
+        for sense in entry.senses() {
+            let pos: Vec<_> = sense.parts_of_speech().collect();
+            if !pos.is_empty() && !expected.contains(&pos) {
+                expected.push(pos);
+            }
+        }
+    }
+    let actual: Vec<_> = crate::observed_pos_combinations()
+        .map(|c| c.to_vec())
+        .collect();
+    assert_eq!(expected, actual);
+}
+
 trait Check<A> {
     fn check(&self, actual: &A);
 }
@@ -75,6 +313,8 @@ impl Check<crate::ReadingElement> for jmdict_traverse::RawReadingElement<'_> {
         let expected = self;
         assert_eq!(expected.reb, actual.text);
         check_vec(&expected.re_inf, actual.infos());
+        check_vec(&expected.re_restr, actual.restrictions_iter);
+        assert_eq!(expected.re_nokanji, actual.is_nokanji);
     }
 }
 
@@ -36,6 +36,13 @@ fn test_gloss_availability() {
     ];
 
     for (lang_code, selected, gloss) in test_cases {
+        assert_eq!(
+            *selected,
+            compiled_languages().iter().any(|l| l.code() == *lang_code),
+            "language code was {}",
+            *lang_code
+        );
+
         let glosses: Vec<_> = entry
             .senses()
             .flat_map(|s| s.glosses())
@@ -53,6 +60,99 @@ fn test_gloss_availability() {
             assert!(glosses.contains(gloss), "glosses were {:?}", glosses);
         }
     }
+
+    //all selected languages appear in some sense, and sense-level language detection agrees with
+    //the glosses
+    for lang in compiled_languages() {
+        assert!(entry.senses().any(|s| s.has_language(*lang)));
+    }
+    assert_eq!(entry.sense_count(), entry.senses().count());
+    for lang in compiled_languages() {
+        let scoped_senses: Vec<_> = entry.senses_for_language(*lang).collect();
+        assert_eq!(
+            entry.gloss_count(*lang),
+            scoped_senses
+                .iter()
+                .map(|s| s.glosses().count())
+                .sum::<usize>()
+        );
+        assert_eq!(
+            scoped_senses.len(),
+            entry.senses().filter(|s| s.has_language(*lang)).count()
+        );
+        for sense in scoped_senses {
+            assert!(sense.glosses().count() > 0);
+            assert!(sense.glosses().all(|g| g.language == *lang));
+            assert_eq!(
+                sense.glosses().count(),
+                sense
+                    .sense()
+                    .glosses()
+                    .filter(|g| g.language == *lang)
+                    .count()
+            );
+            //other accessors are forwarded to the underlying Sense
+            assert_eq!(
+                sense.parts_of_speech().len(),
+                sense.sense().parts_of_speech().len()
+            );
+        }
+    }
+    for sense in entry.senses() {
+        let langs: Vec<_> = sense.languages().collect();
+        assert!(!langs.is_empty());
+        for gloss in sense.glosses() {
+            assert!(langs.contains(&gloss.language));
+        }
+        for (idx, lang) in langs.iter().enumerate() {
+            assert!(sense.has_language(*lang));
+            assert!(!langs[idx + 1..].contains(lang), "duplicate in {:?}", langs);
+        }
+    }
+
+    //the precomputed language set agrees with the glosses, for all entries
+    for entry in entries() {
+        let available = entry.available_languages();
+        assert!(!available.is_empty());
+        for lang in compiled_languages() {
+            let expected = entry.senses().any(|s| s.has_language(*lang));
+            assert_eq!(available.contains(*lang), expected);
+            assert_eq!(entry.has_gloss_language(*lang), expected);
+        }
+        assert_eq!(
+            available.iter().count(),
+            entry
+                .senses()
+                .flat_map(|s| s.languages())
+                .collect::<std::collections::HashSet<_>>()
+                .len()
+        );
+    }
+}
+
+///Checks the conversions between GlossLanguage and ISO 639 codes.
+#[test]
+fn test_iso_codes() {
+    for lang in AllGlossLanguage::all_variants() {
+        assert_eq!(lang.iso_639_2(), lang.code());
+        assert_eq!(AllGlossLanguage::from_iso(lang.code()), Some(*lang));
+        let short_code = lang.iso_639_1().unwrap();
+        assert_eq!(AllGlossLanguage::from_iso(short_code), Some(*lang));
+    }
+
+    assert_eq!(
+        AllGlossLanguage::from_iso("de-CH"),
+        Some(AllGlossLanguage::German)
+    );
+    assert_eq!(
+        AllGlossLanguage::from_iso("DEU"),
+        Some(AllGlossLanguage::German)
+    );
+    assert_eq!(AllGlossLanguage::from_iso("ja"), None);
+    assert_eq!(
+        GlossLanguage::from_iso("en").is_some(),
+        cfg!(feature = "translations-eng")
+    );
 }
 
 ///Spot checks for correct decoding of priorities.
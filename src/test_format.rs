@@ -0,0 +1,307 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_glosses_multi() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let sense = entry.senses().next().unwrap();
+
+    //glosses are grouped by language in the requested order
+    let mut langs = compiled_languages().to_vec();
+    langs.reverse();
+    let glosses = sense.glosses_multi(&langs);
+    assert_eq!(glosses.len(), sense.glosses().count());
+    let mut expected_order = Vec::new();
+    for lang in &langs {
+        expected_order.extend(
+            sense
+                .glosses()
+                .filter(|g| g.language == *lang)
+                .map(|g| g.text),
+        );
+    }
+    let actual_order: Vec<_> = glosses.iter().map(|g| g.text).collect();
+    assert_eq!(actual_order, expected_order);
+
+    //languages that are not requested are not included
+    assert_eq!(sense.glosses_multi(&[]).len(), 0);
+    assert_eq!(sense.format_glosses_multi(&[]), "");
+
+    //languages without glosses in a sense are skipped
+    for sense in entry.senses() {
+        let formatted = sense.format_glosses_multi(compiled_languages());
+        for lang in compiled_languages() {
+            let label = format!("{}: ", lang.iso_639_1().unwrap().to_uppercase());
+            let has_glosses = sense.glosses().any(|g| g.language == *lang);
+            assert_eq!(formatted.contains(&label), has_glosses, "{:?}", formatted);
+        }
+    }
+
+    #[cfg(feature = "translations-eng")]
+    assert_eq!(
+        sense.format_glosses_multi(&[GlossLanguage::English]),
+        "EN: mother; mom; mum; ma"
+    );
+}
+
+#[test]
+fn test_short_gloss() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    for lang in compiled_languages() {
+        let expected = entry
+            .senses()
+            .find(|s| s.has_language(*lang))
+            .and_then(|s| s.glosses().find(|g| g.language == *lang))
+            .map(|g| g.text);
+        assert!(expected.is_some());
+        assert_eq!(entry.short_gloss(*lang), expected);
+    }
+
+    #[cfg(feature = "translations-eng")]
+    assert_eq!(entry.short_gloss(GlossLanguage::English), Some("mother"));
+}
+
+#[test]
+fn test_all_forms() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let forms: Vec<_> = entry.all_forms().collect();
+    assert_eq!(
+        forms.len(),
+        entry.kanji_elements().len() + entry.reading_elements().len()
+    );
+    assert_eq!(forms[0], "お母さん");
+    assert!(forms.contains(&"おかあさん"));
+    assert!(entry.searchable_forms().all(|f| forms.contains(&f)));
+}
+
+#[test]
+fn test_search_only_forms() {
+    for entry in entries() {
+        let expected: Vec<_> = entry
+            .kanji_elements()
+            .filter(|k| !k.infos().any(|i| i == KanjiInfo::SearchOnlyKanjiForm))
+            .map(|k| k.text)
+            .chain(
+                entry
+                    .reading_elements()
+                    .filter(|r| !r.infos().any(|i| i == ReadingInfo::SearchOnlyKanaForm))
+                    .map(|r| r.text),
+            )
+            .collect();
+        let actual: Vec<_> = entry.searchable_forms().collect();
+        assert_eq!(expected, actual);
+
+        //the headword is never a search-only form, unless there is nothing else
+        let headword = entry.display_headword();
+        if entry.kanji_elements().any(|k| !k.is_search_only()) {
+            assert_eq!(Some(headword), entry.primary_kanji().map(|k| k.text));
+            assert!(!entry.primary_kanji().unwrap().is_search_only());
+        } else if entry.reading_elements().any(|r| !r.is_search_only()) {
+            assert!(!entry.primary_reading().is_search_only());
+            assert_eq!(headword, entry.primary_reading().text);
+        }
+        if entry.kanji_elements().len() == 0 {
+            assert!(!entry.reading_differs_from_headword());
+        }
+    }
+
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert_eq!(entry.display_headword(), "お母さん");
+    assert_eq!(entry.primary_reading().text, "おかあさん");
+    assert_eq!(entry.lemma(), "お母さん");
+    assert!(entry.reading_differs_from_headword());
+
+    //為る is usually written in kana (db-minimal does not contain this entry)
+    #[cfg(feature = "translations-eng")]
+    {
+        if let Some(entry) = entries().find(|e| e.number == 1157170) {
+            assert_eq!(entry.display_headword(), "為る");
+            assert_eq!(entry.lemma(), "する");
+        }
+    }
+}
+
+#[test]
+fn test_special_readings() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert!(!entry.kanji_elements().any(|k| k.is_ateji()));
+    assert!(!entry.reading_elements().any(|r| r.is_gikun()));
+
+    //屹度 (きっと) and 海苔 (のり); may be skipped if the entries are not available
+    if let Some(entry) = entries().find(|e| e.number == 1003430) {
+        assert!(entry.kanji_elements().next().unwrap().is_ateji());
+    }
+    if let Some(entry) = entries().find(|e| e.number == 1201620) {
+        assert!(entry.reading_elements().next().unwrap().is_gikun());
+    }
+}
+
+#[test]
+fn test_applicable_kanji() {
+    let texts = |ks: Vec<KanjiElement>| ks.into_iter().map(|k| k.text).collect::<Vec<_>>();
+
+    //unrestricted reading
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let reading = entry.reading_elements().next().unwrap();
+    let expected: Vec<_> = entry.kanji_elements().map(|k| k.text).collect();
+    assert_eq!(texts(reading.applicable_kanji(&entry)), expected);
+    assert!(reading.is_unrestricted());
+
+    //restricted readings (may be skipped if the entry is not available)
+    if let Some(entry) = entries().find(|e| e.number == 1000110) {
+        for reading in entry.reading_elements() {
+            let expected = match reading.text {
+                "シーディープレーヤー" => "ＣＤプレーヤー",
+                "シーディープレイヤー" => "ＣＤプレイヤー",
+                _ => continue,
+            };
+            assert_eq!(texts(reading.applicable_kanji(&entry)), vec![expected]);
+            assert!(!reading.is_unrestricted());
+        }
+    }
+
+    //アカン is not a true reading of 明かん (may be skipped if the entry is not available)
+    if let Some(entry) = entries().find(|e| e.number == 1000230) {
+        for reading in entry.reading_elements() {
+            assert_eq!(reading.is_unrestricted(), reading.text != "アカン");
+        }
+    }
+}
+
+#[test]
+#[cfg(feature = "translations-eng")]
+fn test_to_markdown() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let expected = "**お母さん** 【おかあさん】\n\nお<ruby>母<rt>かあ</rt></ruby>さん\n\n1. *n* mother; mom; mum; ma\n";
+    assert!(entry
+        .to_markdown(GlossLanguage::English)
+        .starts_with(expected));
+
+    //truncation only counts senses with English glosses (this entry also has senses with only
+    //non-English glosses)
+    let expected = format!("{}\n*+1 more*\n", expected);
+    assert_eq!(
+        entry.to_markdown_truncated(GlossLanguage::English, 1),
+        expected
+    );
+    let full = entry.to_markdown(GlossLanguage::English);
+    assert_eq!(entry.to_markdown_truncated(GlossLanguage::English, 2), full);
+
+    //kana-only entries do not have a furigana line
+    let entry = entries().find(|e| e.kanji_elements().len() == 0).unwrap();
+    let markdown = entry.to_markdown(GlossLanguage::English);
+    assert!(markdown.starts_with(&format!("**{}**\n\n1. ", entry.primary_reading().text)));
+    assert!(!markdown.contains("<ruby>"));
+
+    //loanword sources (may be skipped if the entry is not available)
+    if let Some(entry) = entries().find(|e| e.number == 1057250) {
+        let markdown = entry.to_markdown(GlossLanguage::English);
+        assert!(markdown.contains(
+            " (from English (partial, wasei): sub; from German (partial, wasei): Sack)\n"
+        ));
+    }
+
+    //restricted senses (may be skipped if the entry is not available)
+    if let Some(entry) = entries().find(|e| e.number == 1000320) {
+        let markdown = entry.to_markdown(GlossLanguage::English);
+        assert!(markdown.contains(
+            "genitals; private parts; nether regions (only for あそこ, あすこ, アソコ)\n"
+        ));
+    }
+}
+
+#[cfg(feature = "translations-eng")]
+#[test]
+fn test_dedup_glosses() {
+    let gloss = |text, gloss_type| Gloss {
+        language: GlossLanguage::English,
+        text,
+        gloss_type,
+    };
+    let regular = GlossType::RegularTranslation;
+    let literal = GlossType::LiteralTranslation;
+
+    //only exact duplicates are removed, and the first occurrence is kept in place
+    let input = vec![
+        gloss("mother", regular),
+        gloss("mom", regular),
+        gloss("mother", literal),
+        gloss("mom", regular),
+        gloss("mother", regular),
+    ];
+    let expected = vec![
+        gloss("mother", regular),
+        gloss("mom", regular),
+        gloss("mother", literal),
+    ];
+    assert_eq!(dedup_glosses(input), expected);
+
+    //senses without duplicates are unchanged
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let sense = entry.senses().next().unwrap();
+    assert_eq!(sense.glosses_deduped(), sense.glosses().collect::<Vec<_>>());
+}
+
+#[test]
+fn test_entry_without_senses() {
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert!(entry.has_any_gloss());
+
+    //entries from the database always have senses, so we need to build one without senses
+    let empty = Entry {
+        senses_iter: Range::new(0, 0).into(),
+        languages: LanguageSet(0),
+        ..entry
+    };
+    assert!(!empty.has_any_gloss());
+    assert_eq!(empty.senses().count(), 0);
+    assert_eq!(empty.sense_count(), 0);
+    assert_eq!(
+        empty.kanji_elements().count(),
+        entry.kanji_elements().count()
+    );
+    assert_eq!(empty.primary_reading().text, entry.primary_reading().text);
+    assert_eq!(empty.display_headword(), entry.display_headword());
+    for &lang in compiled_languages() {
+        assert!(!empty.has_gloss_language(lang));
+        assert_eq!(empty.short_gloss(lang), None);
+        assert_eq!(empty.senses_for_language(lang).count(), 0);
+        assert_eq!(empty.gloss_count(lang), 0);
+        assert!(empty
+            .to_markdown(lang)
+            .starts_with("**お母さん** 【おかあさん】\n"));
+        assert!(!empty.to_markdown(lang).contains("1. "));
+    }
+}
+
+#[test]
+fn test_describe_loanword_source() {
+    let source = |text, language, is_partial, is_wasei| LoanwordSource {
+        text,
+        language,
+        is_partial,
+        is_wasei,
+    };
+    let cases = [
+        (source("Arbeit", "ger", false, false), "from German: Arbeit"),
+        (source("", "eng", false, false), "from English"),
+        (
+            source("kombinat", "rus", true, false),
+            "from Russian (partial): kombinat",
+        ),
+        (source("", "eng", false, true), "from English (wasei)"),
+        (
+            source("price", "eng", true, true),
+            "from English (partial, wasei): price",
+        ),
+        (source("word", "xyz", false, false), "from xyz: word"),
+    ];
+    for (source, expected) in &cases {
+        assert_eq!(source.describe(), *expected);
+    }
+}
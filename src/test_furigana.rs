@@ -0,0 +1,103 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::furigana::align;
+use crate::*;
+
+fn k(text: &'static str, reading: &'static str) -> ReadingSpan {
+    ReadingSpan::Kanji { text, reading }
+}
+
+fn o(text: &'static str) -> ReadingSpan {
+    ReadingSpan::Kana { text }
+}
+
+#[test]
+fn test_align() {
+    assert_eq!(
+        align("持ち運ぶ", "もちはこぶ"),
+        Some(vec![k("持", "も"), o("ち"), k("運", "はこ"), o("ぶ")])
+    );
+    assert_eq!(
+        align("話し合い", "はなしあい"),
+        Some(vec![k("話", "はな"), o("し"), k("合", "あ"), o("い")])
+    );
+    assert_eq!(
+        align("お母さん", "おかあさん"),
+        Some(vec![o("お"), k("母", "かあ"), o("さん")])
+    );
+    assert_eq!(
+        align("唐揚げ", "からあげ"),
+        Some(vec![k("唐揚", "からあ"), o("げ")])
+    );
+    assert_eq!(align("日本", "にほん"), Some(vec![k("日本", "にほん")]));
+    assert_eq!(
+        align("一ヶ月", "いっかげつ"),
+        Some(vec![k("一ヶ月", "いっかげつ")])
+    );
+    //kana in the kanji element may be in a different script than in the reading
+    assert_eq!(
+        align("消しゴム", "けしごむ"),
+        Some(vec![k("消", "け"), o("しゴム")])
+    );
+    //kana that does not match the reading
+    assert_eq!(align("持ち運ぶ", "もちはこべ"), None);
+    //kanji runs must be read with at least one character
+    assert_eq!(align("持ち", "ち"), None);
+}
+
+#[test]
+fn test_reading_with_okurigana() {
+    //Tests may be skipped if the test entry is not available, since entry
+    //availability depends on the selection of target languages.
+    let find = |keb| entries().find(|e| e.kanji_elements().next().map(|k| k.text) == Some(keb));
+
+    if let Some(entry) = find("お母さん") {
+        assert_eq!(
+            entry.reading_with_okurigana(),
+            vec![o("お"), k("母", "かあ"), o("さん")]
+        );
+    }
+
+    //kana between kanji must not be annotated
+    if let Some(entry) = find("持ち込む") {
+        assert_eq!(
+            entry.reading_with_okurigana(),
+            vec![k("持", "も"), o("ち"), k("込", "こ"), o("む")]
+        );
+    }
+
+    //entries without kanji elements must not panic, and there is nothing to annotate
+    for entry in entries().filter(|e| e.kanji_elements().len() == 0) {
+        let reading = entry.primary_reading().text;
+        assert_eq!(entry.reading_with_okurigana(), vec![o(reading)]);
+    }
+}
+
+#[test]
+fn test_furigana_for() {
+    let words = ["お母さん", "ではない言葉", "おかあさん", "お母さん"];
+    let mut results = furigana_for(&words);
+    let actual: Vec<_> = results
+        .by_ref()
+        .map(|(entry, spans)| (entry.number, spans))
+        .collect();
+    let expected = vec![
+        (1002650, vec![o("お"), k("母", "かあ"), o("さん")]),
+        (1002650, vec![o("おかあさん")]),
+        (1002650, vec![o("お"), k("母", "かあ"), o("さん")]),
+    ];
+    assert_eq!(actual, expected);
+    assert_eq!(results.unresolved(), &["ではない言葉".to_string()]);
+
+    //homographs resolve to the most common entry: はし is 橋 rather than 箸 (may be skipped if the
+    //entries are not available)
+    let has_entry = |n| entries().any(|e: Entry| e.number == n);
+    if has_entry(1237410) && has_entry(1476410) {
+        let (entry, _) = furigana_for(&["はし"]).next().unwrap();
+        assert_eq!(entry.number, 1237410);
+    }
+}
@@ -0,0 +1,36 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_homophones() {
+    let groups: Vec<_> = homophones().collect();
+
+    let mut last_reading = String::new();
+    for (reading, group) in &groups {
+        //groups are ordered by reading and have at least two distinct entries
+        assert!(*reading > last_reading);
+        last_reading = reading.clone();
+        assert!(group.len() > 1);
+        for (idx, entry) in group.iter().enumerate() {
+            assert!(entry.reading_elements().any(|r| r.text == reading));
+            assert!(group[(idx + 1)..].iter().all(|e| e.number != entry.number));
+        }
+    }
+
+    //はし: 橋 (1237410), 箸 (1476410) and 端 (1581610); may be skipped if the entries are not
+    //available
+    let has_entry = |n| entries().any(|e: Entry| e.number == n);
+    if [1237410, 1476410, 1581610].iter().all(|&n| has_entry(n)) {
+        let (_, group) = groups.iter().find(|(r, _)| r == "はし").unwrap();
+        let numbers: Vec<_> = group.iter().map(|e| e.number).collect();
+        let position = |n| numbers.iter().position(|&m| m == n).unwrap();
+        //橋 and 端 are both in frequency bucket 5 and therefore come before 箸 (bucket 19)
+        assert!(position(1237410) < position(1581610));
+        assert!(position(1581610) < position(1476410));
+    }
+}
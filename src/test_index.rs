@@ -0,0 +1,86 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+use jmdict_traverse::index::{is_kanji, priority_rank, IndexBuilder};
+
+///Rebuilds the kanji index in the same way as build.rs, but with entries visited in the given order.
+fn build_kanji_index(entries: impl Iterator<Item = (usize, Entry)>) -> (Vec<u32>, Vec<u32>) {
+    let mut builder = IndexBuilder::default();
+    for (idx, entry) in entries {
+        for k in entry.kanji_elements() {
+            for c in k.text.chars().filter(|&c| is_kanji(c)) {
+                builder.insert(c as u32, priority_rank(k.priority), idx as u32);
+            }
+        }
+    }
+    builder.encode()
+}
+
+#[test]
+fn test_index_is_deterministic() {
+    let all: Vec<(usize, Entry)> = entries().enumerate().collect();
+    let forward = build_kanji_index(all.iter().copied());
+    let backward = build_kanji_index(all.iter().rev().copied());
+    assert_eq!(forward, backward);
+
+    //the index embedded by build.rs must be identical as well
+    #[cfg(feature = "index-kanji")]
+    {
+        let (keys, values) = payload::kanji_index();
+        assert_eq!(forward, (keys.to_vec(), values.to_vec()));
+    }
+}
+
+#[cfg(feature = "index-kanji")]
+#[test]
+fn test_entries_containing_kanji() {
+    for c in "母猫日本語".chars() {
+        let mut expected = Vec::new();
+        let mut common = std::collections::HashSet::new();
+        for entry in entries() {
+            let mut matches = entry.kanji_elements().filter(|k| k.text.contains(c));
+            if let Some(k) = matches.next() {
+                expected.push(entry.number);
+                if k.priority.is_common() || matches.any(|k| k.priority.is_common()) {
+                    common.insert(entry.number);
+                }
+            }
+        }
+        let mut actual: Vec<u32> = entries_containing_kanji(c).map(|e| e.number).collect();
+
+        //common words come first
+        assert!(actual[..common.len()].iter().all(|n| common.contains(n)));
+
+        expected.sort_unstable();
+        actual.sort_unstable();
+        assert_eq!(expected, actual);
+    }
+
+    assert_eq!(entries_containing_kanji('a').count(), 0);
+}
+
+#[cfg(feature = "index-frequency")]
+#[test]
+fn test_entries_by_frequency() {
+    use jmdict_traverse::index::frequency_score;
+    let score = |e: &Entry| {
+        let ke_pris = e.kanji_elements().map(|k| k.priority);
+        let re_pris = e.reading_elements().map(|r| r.priority);
+        ke_pris.chain(re_pris).map(frequency_score).min().unwrap()
+    };
+
+    let actual: Vec<(u32, u32)> = entries_by_frequency()
+        .map(|e| (score(&e), e.number))
+        .collect();
+    assert_eq!(actual.len(), entries().count());
+
+    //sorted by score, then by sequence number, without duplicates
+    let mut expected = actual.clone();
+    expected.sort_unstable();
+    expected.dedup();
+    assert_eq!(actual, expected);
+}
@@ -0,0 +1,71 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+fn reading(text: &'static str) -> ReadingElement {
+    ReadingElement {
+        text,
+        priority: Default::default(),
+        info_iter: Range::new(0, 0).into(),
+        restrictions_iter: Range::new(0, 0).into(),
+        is_nokanji: false,
+    }
+}
+
+#[test]
+fn test_is_katakana() {
+    assert!(reading("ガタガタ").is_katakana());
+    assert!(reading("コーヒー").is_katakana());
+    assert!(reading("コーヒー・カップ").is_katakana());
+    assert!(reading("ｺｰﾋｰ").is_katakana());
+    assert!(!reading("がたがた").is_katakana());
+    assert!(!reading("ガタがた").is_katakana());
+    assert!(!reading("ー・ー").is_katakana());
+    assert!(!reading("").is_katakana());
+}
+
+#[test]
+fn test_mora_count() {
+    let cases = [
+        ("きょう", 2),
+        ("がっこう", 4),
+        ("コーヒー", 4),
+        ("しんぶん", 4),
+        ("ファン", 2),
+        ("ちぇっ", 2),
+        ("ｷｮｳ", 2),
+        ("ｶﾞｯｺｳ", 4),
+        ("コーヒー・カップ", 7),
+        ("ＣＤプレーヤー", 5),
+        ("ゃ", 1),
+        ("", 0),
+    ];
+    for (text, expected) in &cases {
+        assert_eq!(reading(text).mora_count(), *expected, "reading: {}", text);
+    }
+
+    for entry in entries_with_mora_count(2).take(100) {
+        assert!(entry.reading_elements().any(|r| r.mora_count() == 2));
+    }
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert!(entries_with_mora_count(5).any(|e| e.number == entry.number));
+}
+
+#[test]
+fn test_is_likely_loanword() {
+    //Tests may be skipped if the test entry is not available, since entry
+    //availability depends on the selection of target languages.
+    let find = |reb| entries().find(|e| e.reading_elements().any(|r| r.text == reb));
+
+    //first reading is katakana (this is an onomatopoeia, hence "likely")
+    if let Some(entry) = find("ガタガタ") {
+        assert!(entry.is_likely_loanword());
+    }
+    if let Some(entry) = find("おかあさん") {
+        assert!(!entry.is_likely_loanword());
+    }
+}
@@ -4,7 +4,7 @@
 * Refer to the file "LICENSE" for details.
 *******************************************************************************/
 
-use crate::entries;
+use crate::*;
 
 #[test]
 fn test_entry_order() {
@@ -14,3 +14,38 @@ fn test_entry_order() {
         prev = entry.number;
     }
 }
+
+#[test]
+fn test_gloss_order() {
+    //Glosses must appear in the same order as in the JMdict, since that order conveys
+    //significance. (The order in the XML is also checked by test_consistency, but that test
+    //would not notice if the Go preprocessor reordered glosses.)
+    #[cfg(feature = "translations-eng")]
+    {
+        let entry = entries().find(|e| e.number == 1002650).unwrap();
+        let glosses: Vec<_> = entry
+            .senses()
+            .next()
+            .unwrap()
+            .glosses()
+            .map(|g| g.text)
+            .collect();
+        assert_eq!(glosses, vec!["mother", "mom", "mum", "ma"]);
+    }
+
+    //This entry is not in db-minimal.
+    #[cfg(all(feature = "translations-eng", not(feature = "db-minimal")))]
+    {
+        if let Some(entry) = entries().find(|e| e.kanji_elements().any(|k| k.text == "折角")) {
+            let glosses: Vec<Vec<_>> = entry
+                .senses_for_language(GlossLanguage::English)
+                .map(|s| s.glosses().map(|g| g.text).collect())
+                .collect();
+            assert_eq!(glosses[0], vec!["with trouble", "at great pains"]);
+            assert_eq!(
+                glosses[1],
+                vec!["rare", "valuable", "precious", "long-awaited"]
+            );
+        }
+    }
+}
@@ -0,0 +1,29 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_permalink() {
+    for entry in entries() {
+        let id = entry.permalink_id();
+        assert!(id.len() >= 7 && id.bytes().all(|b| b.is_ascii_digit()));
+        assert_eq!(
+            entry_by_permalink(&id).map(|e| e.number),
+            Some(entry.number)
+        );
+    }
+
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert_eq!(entry.permalink_id(), "1002650");
+
+    //invalid or unknown IDs
+    assert!(entry_by_permalink("").is_none());
+    assert!(entry_by_permalink("+1002650").is_none());
+    assert!(entry_by_permalink("1002650/").is_none());
+    assert!(entry_by_permalink("99999999999").is_none());
+    assert!(entry_by_permalink("0000001").is_none());
+}
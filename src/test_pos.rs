@@ -0,0 +1,106 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+///Returns (is_verb, is_noun, is_adjective, is_adverb, is_expression) for the first sense of the
+///given entry, or None if the entry is not included in this build.
+#[cfg(feature = "translations-eng")]
+fn categories_of(number: u32) -> Option<(bool, bool, bool, bool, bool)> {
+    let entry = entries().find(|e| e.number == number)?;
+    let s = entry.senses().next()?;
+    Some((
+        s.is_verb(),
+        s.is_noun(),
+        s.is_adjective(),
+        s.is_adverb(),
+        s.is_expression(),
+    ))
+}
+
+#[test]
+fn test_pos_categories() {
+    //every sense that has a part of speech starting with "v" or "adj-" is a verb or adjective
+    for entry in entries() {
+        for sense in entry.senses() {
+            for pos in sense.parts_of_speech() {
+                if pos.code().starts_with('v') {
+                    assert!(sense.is_verb());
+                }
+                if pos.code().starts_with("adj-") {
+                    assert!(sense.is_adjective());
+                }
+                if pos == PartOfSpeech::Expression {
+                    assert!(sense.is_expression());
+                }
+            }
+        }
+    }
+}
+
+//Senses in other languages often do not repeat the part of speech, so the spot checks only work
+//with English glosses.
+#[cfg(feature = "translations-eng")]
+#[test]
+fn test_pos_categories_of_common_words() {
+    //お母さん: n
+    let expected = (false, true, false, false, false);
+    assert_eq!(categories_of(1002650), Some(expected));
+
+    //db-minimal does not contain the following entries
+    let cases = [
+        //食べる: v1, vt
+        (1358280, (true, false, false, false, false)),
+        //行く: v5k-s, vi
+        (1578850, (true, false, false, false, false)),
+        //勉強: n, vs
+        (1512670, (true, true, false, false, false)),
+        //高い: adj-i
+        (1283190, (false, false, true, false, false)),
+        //静か: adj-na
+        (1381820, (false, false, true, false, false)),
+        //ゆっくり: adv, adv-to, vs
+        (1013050, (true, false, false, true, false)),
+    ];
+    for (number, expected) in cases.iter() {
+        if let Some(actual) = categories_of(*number) {
+            assert_eq!(actual, *expected, "entry {}", number);
+        }
+    }
+}
+
+#[cfg(feature = "translations-eng")]
+#[test]
+fn test_transitivity() {
+    use Transitivity::*;
+    let find = |number| entries().find(|e| e.number == number);
+
+    let entry = find(1002650).unwrap();
+    assert_eq!(entry.transitivity(), Unknown);
+    assert_eq!(entry.transitivity_pair().map(|e| e.number), None);
+
+    //db-minimal does not contain the following entries
+    let cases = [
+        //開ける (あける) and 開く (あく) have senses of either transitivity, but are mainly
+        //transitive and intransitive, respectively
+        (1202450, Both, Some(1586270)),
+        (1586270, Both, Some(1202450)),
+        //閉める and 閉まる
+        (1508590, Transitive, Some(1436560)),
+        (1436560, Intransitive, Some(1508590)),
+        //開く (ひらく) is both transitive and intransitive
+        (1202440, Both, None),
+    ];
+    for &(number, transitivity, pair) in &cases {
+        if let Some(entry) = find(number) {
+            assert_eq!(entry.transitivity(), transitivity, "entry {}", number);
+            if pair.map_or(true, |n| find(n).is_some()) {
+                let actual = entry.transitivity_pair().map(|e| e.number);
+                assert_eq!(actual, pair, "entry {}", number);
+            }
+        }
+    }
+}
@@ -0,0 +1,206 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_modern_entries() {
+    let mut modern = modern_entries().peekable();
+    let mut excluded_count = 0;
+    for entry in entries() {
+        let is_dated = entry.senses().all(|s| s.is_archaic_or_rare());
+        if modern.peek().map(|e| e.number) == Some(entry.number) {
+            assert!(!is_dated, "entry {} should be excluded", entry.number);
+            modern.next();
+        } else {
+            assert!(is_dated, "entry {} should be included", entry.number);
+            excluded_count += 1;
+        }
+    }
+    assert!(modern.next().is_none());
+
+    //an unfiltered query yields all entries
+    assert_eq!(Query::new().entries().count(), entries().count());
+    assert_eq!(
+        Query::new().modern_only().entries().count() + excluded_count,
+        entries().count()
+    );
+}
+
+#[test]
+fn test_pos_filters() {
+    use PartOfSpeech::*;
+    let has = |s: &Sense, pos: PartOfSpeech| s.parts_of_speech().any(|p| p == pos);
+    let check = |query: Query, predicate: &dyn Fn(&Sense) -> bool| {
+        let actual: Vec<u32> = query.entries().map(|e| e.number).collect();
+        let expected: Vec<u32> = entries()
+            .filter(|e| e.senses().any(|s| predicate(&s)))
+            .map(|e| e.number)
+            .collect();
+        assert_eq!(actual, expected);
+        actual
+    };
+
+    let transitive = check(Query::new().pos_all(&[TransitiveVerb]), &|s| {
+        has(s, TransitiveVerb)
+    });
+    let intransitive = check(Query::new().pos_all(&[IntransitiveVerb]), &|s| {
+        has(s, IntransitiveVerb)
+    });
+    let either = check(
+        Query::new().pos_any(&[TransitiveVerb, IntransitiveVerb]),
+        &|s| has(s, TransitiveVerb) || has(s, IntransitiveVerb),
+    );
+    assert!(either.len() >= transitive.len().max(intransitive.len()));
+
+    //filters are evaluated per sense, not across senses
+    check(
+        Query::new()
+            .pos_all(&[IchidanVerb])
+            .pos_all(&[TransitiveVerb]),
+        &|s| has(s, IchidanVerb) && has(s, TransitiveVerb),
+    );
+    check(
+        Query::new()
+            .pos_any(&[IchidanVerb, GodanKuVerb])
+            .pos_any(&[IntransitiveVerb]),
+        &|s| (has(s, IchidanVerb) || has(s, GodanKuVerb)) && has(s, IntransitiveVerb),
+    );
+
+    //開ける exists as both a transitive and an intransitive verb (db-minimal does not contain
+    //these entries)
+    #[cfg(feature = "translations-eng")]
+    {
+        let query = Query::new().pos_all(&[IchidanVerb, TransitiveVerb]);
+        if let Some(e) = entries().find(|e| e.number == 1202450) {
+            assert!(query.matches(&e));
+        }
+        if let Some(e) = entries().find(|e| e.number == 1202460) {
+            assert!(!query.matches(&e));
+        }
+    }
+
+    //edge cases
+    assert_eq!(
+        Query::new().pos_all(&[]).entries().count(),
+        entries().count()
+    );
+    assert_eq!(Query::new().pos_any(&[]).entries().count(), 0);
+}
+
+#[test]
+fn test_misc_filters() {
+    use SenseInfo::*;
+    let has = |s: &Sense, info: SenseInfo| s.infos().any(|i| i == info);
+    let check = |query: Query, predicate: &dyn Fn(&Sense) -> bool| {
+        let actual: Vec<u32> = query.entries().map(|e| e.number).collect();
+        let expected: Vec<u32> = entries()
+            .filter(|e| e.senses().any(|s| predicate(&s)))
+            .map(|e| e.number)
+            .collect();
+        assert_eq!(actual, expected);
+    };
+
+    check(
+        Query::new()
+            .exclude_misc(&[VulgarTerm, XRated])
+            .exclude_misc(&[Slang]),
+        &|s| !has(s, VulgarTerm) && !has(s, XRated) && !has(s, Slang),
+    );
+    check(Query::new().require_misc(&[Slang, InternetSlang]), &|s| {
+        has(s, Slang) || has(s, InternetSlang)
+    });
+    //sense-level filters are evaluated together on the same sense
+    check(
+        Query::new()
+            .require_misc(&[Colloquialism])
+            .exclude_misc(&[VulgarTerm])
+            .pos_any(&[PartOfSpeech::CommonNoun]),
+        &|s| {
+            has(s, Colloquialism)
+                && !has(s, VulgarTerm)
+                && s.parts_of_speech().any(|p| p == PartOfSpeech::CommonNoun)
+        },
+    );
+
+    //駅弁 has a neutral first sense and a vulgar second sense: the entry matches either way, but
+    //only the respective sense matches on its own (db-minimal does not contain this entry)
+    #[cfg(feature = "translations-eng")]
+    {
+        if let Some(e) = entries().find(|e| e.number == 1175240) {
+            let senses: Vec<_> = e.senses().collect();
+            assert!(!has(&senses[0], VulgarTerm));
+            assert!(has(&senses[1], VulgarTerm));
+
+            let query = Query::new().exclude_misc(&[VulgarTerm]);
+            assert!(query.matches(&e));
+            assert!(query.matches_sense(&senses[0]));
+            assert!(!query.matches_sense(&senses[1]));
+
+            let query = Query::new().require_misc(&[VulgarTerm]);
+            assert!(query.matches(&e));
+            assert!(!query.matches_sense(&senses[0]));
+            assert!(query.matches_sense(&senses[1]));
+        }
+    }
+
+    //edge cases
+    assert_eq!(
+        Query::new().exclude_misc(&[]).entries().count(),
+        entries().count()
+    );
+    assert_eq!(Query::new().require_misc(&[]).entries().count(), 0);
+}
+
+#[test]
+fn test_search_anywhere() {
+    //matches in kanji elements, reading elements and glosses
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let gloss = entry
+        .senses()
+        .next()
+        .unwrap()
+        .glosses()
+        .next()
+        .unwrap()
+        .text;
+    for query in &["母さ", "かあさ", gloss] {
+        let numbers: Vec<u32> = search_anywhere(query).map(|e| e.number).collect();
+        assert!(numbers.contains(&1002650), "no match for {:?}", query);
+
+        //results are unique and in database order
+        let mut sorted = numbers.clone();
+        sorted.sort_unstable();
+        sorted.dedup();
+        assert_eq!(numbers, sorted);
+    }
+
+    assert_eq!(search_anywhere("").count(), entries().count());
+    assert_eq!(search_anywhere("\u{0}").count(), 0);
+}
+
+#[test]
+fn test_has_frequency_rank() {
+    let has_rank = |e: &Entry| {
+        e.kanji_elements().any(|k| k.priority.frequency_bucket > 0)
+            || e.reading_elements()
+                .any(|r| r.priority.frequency_bucket > 0)
+    };
+    let actual: Vec<u32> = Query::new()
+        .has_frequency_rank()
+        .entries()
+        .map(|e| e.number)
+        .collect();
+    let expected: Vec<u32> = entries()
+        .filter(|e| has_rank(e))
+        .map(|e| e.number)
+        .collect();
+    assert_eq!(actual, expected);
+
+    //お母さん is in frequency bucket 5
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    assert!(Query::new().has_frequency_rank().matches(&entry));
+}
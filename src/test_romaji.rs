@@ -0,0 +1,52 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_romaji_styles() {
+    use RomajiStyle::*;
+    //(input, Hepburn, Kunrei, Nihon-shiki) for the kana that differ between the styles
+    let cases = [
+        ("し", "shi", "si", "si"),
+        ("じ", "ji", "zi", "zi"),
+        ("ち", "chi", "ti", "ti"),
+        ("ぢ", "ji", "zi", "di"),
+        ("つ", "tsu", "tu", "tu"),
+        ("づ", "zu", "zu", "du"),
+        ("ふ", "fu", "hu", "hu"),
+        ("を", "o", "o", "wo"),
+        ("しゃ", "sha", "sya", "sya"),
+        ("じゅ", "ju", "zyu", "zyu"),
+        ("ちょ", "cho", "tyo", "tyo"),
+        ("ぢゃ", "ja", "zya", "dya"),
+        ("まっちゃ", "matcha", "mattya", "mattya"),
+        ("みっつ", "mittsu", "mittu", "mittu"),
+    ];
+    for (input, hepburn, kunrei, nihon) in &cases {
+        assert_eq!(kana_to_romaji(input, Hepburn), *hepburn, "input: {}", input);
+        assert_eq!(kana_to_romaji(input, Kunrei), *kunrei, "input: {}", input);
+        assert_eq!(
+            kana_to_romaji(input, NihonShiki),
+            *nihon,
+            "input: {}",
+            input
+        );
+    }
+
+    //the same in all styles
+    for &style in &[Hepburn, Kunrei, NihonShiki] {
+        assert_eq!(kana_to_romaji("きょうと", style), "kyouto");
+        assert_eq!(kana_to_romaji("ほんや", style), "hon'ya");
+        assert_eq!(kana_to_romaji("コンピューター", style), "konpyuutaa");
+        assert_eq!(kana_to_romaji("パーティー", style), "paatii");
+        assert!(kana_to_romaji("ＡＢＣじゅん", style).starts_with("ＡＢＣ"));
+    }
+
+    let entry = entries().find(|e| e.number == 1002650).unwrap();
+    let reading = entry.reading_elements().next().unwrap();
+    assert_eq!(reading.to_romaji(Hepburn), "okaasan");
+}
@@ -0,0 +1,27 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_entry_counts() {
+    assert_eq!(entry_count(), entries().count());
+    assert_eq!(count_where(|_| true), entry_count());
+    assert_eq!(count_where(|_| false), 0);
+
+    //the precomputed counts must agree with a full scan
+    let is_common = |e: &Entry| {
+        e.kanji_elements().any(|k| k.priority.is_common())
+            || e.reading_elements().any(|r| r.priority.is_common())
+    };
+    assert_eq!(common_entry_count(), count_where(is_common));
+    for &lang in compiled_languages() {
+        assert_eq!(
+            entry_count_for_language(lang),
+            count_where(|e| e.has_gloss_language(lang))
+        );
+    }
+}
@@ -0,0 +1,57 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::suggest::bounded_distance;
+use crate::*;
+
+fn distance(a: &str, b: &str) -> Option<usize> {
+    let a: Vec<char> = a.chars().collect();
+    let b: Vec<char> = b.chars().collect();
+    bounded_distance(&a, &b, 4)
+}
+
+#[test]
+fn test_bounded_distance() {
+    assert_eq!(distance("おかあさん", "おかあさん"), Some(0));
+    //voiced and small kana count as half an edit
+    assert_eq!(distance("おかあさん", "おがあさん"), Some(1));
+    assert_eq!(distance("きつて", "きって"), Some(1));
+    assert_eq!(distance("はん", "ぱん"), Some(1));
+    //other substitutions, insertions and deletions count as a full edit
+    assert_eq!(distance("おかあさん", "おとうさん"), Some(4));
+    assert_eq!(distance("おかあさん", "おかさん"), Some(2));
+    assert_eq!(distance("おかさん", "おかあさん"), Some(2));
+    //beyond the bound
+    assert_eq!(distance("おかあさん", "おじいさま"), None);
+    assert_eq!(distance("おかあさん", "おか"), None);
+}
+
+#[test]
+fn test_suggest_readings() {
+    //Tests may be skipped if the test entry is not available, since entry
+    //availability depends on the selection of target languages.
+    if !entries().any(|e| e.reading_elements().any(|r| r.text == "おかあさん")) {
+        return;
+    }
+
+    let suggestions = suggest_readings("おかーさん", 5);
+    assert!(!suggestions.is_empty());
+    assert!(suggestions.len() <= 5);
+    assert!(
+        suggestions.iter().any(|(text, _)| *text == "おかあさん"),
+        "suggestions were {:?}",
+        suggestions.iter().map(|s| s.0).collect::<Vec<_>>()
+    );
+    for (text, entry) in &suggestions {
+        assert!(entry.reading_elements().any(|r| r.text == *text));
+    }
+
+    //katakana queries match hiragana readings and vice versa
+    let suggestions = suggest_readings("オカアサン", 1);
+    assert_eq!(suggestions[0].0, "おかあさん");
+
+    assert!(suggest_readings("おかあさん", 0).is_empty());
+}
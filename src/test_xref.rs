@@ -0,0 +1,122 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+
+#[test]
+fn test_parse_cross_reference() {
+    let test_cases = &[
+        ("どの", "どの", None, None),
+        ("この・1", "この", None, Some(1)),
+        ("彼の・あの", "彼の", Some("あの"), None),
+        ("明後日・あさって・2", "明後日", Some("あさって"), Some(2)),
+    ];
+    for (input, text, reading, sense_number) in test_cases {
+        assert_eq!(
+            CrossReference::parse(input),
+            CrossReference {
+                text,
+                reading: *reading,
+                sense_number: *sense_number,
+            }
+        );
+    }
+}
+
+#[test]
+fn test_resolve_cross_reference() {
+    //The set of available entries depends on the selection of target languages, so we need to
+    //feature-gate on the gloss language.
+    #[cfg(feature = "translations-eng")]
+    {
+        //この and その appear in the cross-references of 彼の; この is ambiguous since it is also
+        //a reading of 九, but 此の is preferred because この is its first reading
+        let resolve = |r| CrossReference::parse(r).resolve().map(|e| e.number);
+        assert_eq!(resolve("その・1"), Some(1006830));
+        //`db-minimal` does not contain the entry for 此の
+        #[cfg(not(feature = "db-minimal"))]
+        assert_eq!(resolve("この・1"), Some(1582920));
+    }
+
+    assert!(CrossReference::parse("存在しない言葉").resolve().is_none());
+}
+
+#[test]
+fn test_resolve_sense() {
+    assert_eq!(CrossReference::parse("引く・1").target_sense(), Some(0));
+    assert_eq!(
+        CrossReference::parse("引く・ひく・3").target_sense(),
+        Some(2)
+    );
+    assert_eq!(CrossReference::parse("引く").target_sense(), None);
+    assert_eq!(CrossReference::parse("引く・0").target_sense(), None);
+
+    //お母さん is always present; sense numbers out of range yield the entry without a sense
+    let resolve = |r| {
+        CrossReference::parse(r)
+            .resolve_sense()
+            .map(|(e, idx)| (e.number, idx))
+    };
+    assert_eq!(resolve("お母さん"), Some((1002650, None)));
+    assert_eq!(resolve("お母さん・1"), Some((1002650, Some(0))));
+    assert_eq!(resolve("お母さん・99"), Some((1002650, None)));
+    assert_eq!(resolve("存在しない言葉・1"), None);
+}
+
+#[test]
+fn test_validate_cross_references() {
+    //resolve() is rather slow, so we only spot-check some of the results
+    let broken = validate_cross_references();
+    for r in broken.iter().take(50) {
+        assert!(
+            CrossReference::parse(r.target).resolve().is_none(),
+            "{:?} was reported, but can be resolved",
+            r
+        );
+    }
+}
+
+#[test]
+fn test_resolve_all() {
+    //resolve() is rather slow, so we only check a few entries
+    let with_refs = entries().filter(|e| {
+        e.senses()
+            .any(|s| s.cross_references().next().is_some() || s.antonyms().next().is_some())
+    });
+    for entry in with_refs.take(5) {
+        let resolved = entry.resolve_all();
+        assert_eq!(resolved.entry.number, entry.number);
+
+        let check = |actual: &[ResolvedReference], expected: Vec<(usize, &'static str)>| {
+            assert_eq!(actual.len(), expected.len());
+            for (r, (sense_index, text)) in actual.iter().zip(expected) {
+                assert_eq!(r.sense_index, sense_index);
+                assert_eq!(r.reference, CrossReference::parse(text));
+                let expected_target = r.reference.resolve().map(|e| e.number);
+                assert_eq!(r.target.map(|e| e.number), expected_target);
+            }
+        };
+        let senses = || entry.senses().enumerate();
+        check(
+            &resolved.cross_references,
+            senses()
+                .flat_map(|(idx, s)| s.cross_references().map(move |r| (idx, r)))
+                .collect(),
+        );
+        check(
+            &resolved.antonyms,
+            senses()
+                .flat_map(|(idx, s)| s.antonyms().map(move |r| (idx, r)))
+                .collect(),
+        );
+
+        let related = resolved.related_entries();
+        let mut numbers: Vec<u32> = related.iter().map(|e| e.number).collect();
+        numbers.sort_unstable();
+        numbers.dedup();
+        assert_eq!(numbers.len(), related.len());
+    }
+}
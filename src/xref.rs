@@ -0,0 +1,284 @@
+/*******************************************************************************
+* Copyright 2021 Stefan Majewsky <majewsky@gmx.net>
+* SPDX-License-Identifier: Apache-2.0
+* Refer to the file "LICENSE" for details.
+*******************************************************************************/
+
+use crate::*;
+use std::collections::HashMap;
+
+///A structured representation of the references returned by [Sense::cross_references()] and
+///[Sense::antonyms()].
+///
+///In the JMdict, references have one of the forms `text`, `text・reading`, `text・number` or
+///`text・reading・number`, where `text` is the text of a [KanjiElement] or [ReadingElement] of the
+///target [Entry], `reading` is the text of a [ReadingElement] of the target entry, and `number`
+///is the 1-based index of a [Sense] in the target entry.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct CrossReference {
+    pub text: &'static str,
+    pub reading: Option<&'static str>,
+    ///The 1-based sense number as it appears in the JMdict. Note that this refers to the senses
+    ///in the full JMdict, which may differ from the senses included in this build.
+    pub sense_number: Option<usize>,
+}
+
+impl CrossReference {
+    ///Parses a reference as returned by [Sense::cross_references()] or [Sense::antonyms()].
+    pub fn parse(input: &'static str) -> Self {
+        let mut parts: Vec<&'static str> = input.split('・').collect();
+        let mut sense_number = None;
+        if parts.len() > 1 {
+            let last = parts[parts.len() - 1];
+            if !last.is_empty() && last.bytes().all(|b| b.is_ascii_digit()) {
+                sense_number = last.parse().ok();
+                parts.pop();
+            }
+        }
+        Self {
+            text: parts[0],
+            reading: parts.get(1).copied(),
+            sense_number,
+        }
+    }
+
+    ///Finds the entry that this reference points to, or `None` if there is no such entry in this
+    ///build. Note that, depending on the compile-time configuration, the target entry may not be
+    ///included in the build (e.g. when it only consists of uncommon vocabulary).
+    ///
+    ///If the reference is ambiguous, entries where the referenced text is the first kanji element
+    ///or reading element are preferred. Beyond that, the entry with the lowest sequence number
+    ///wins.
+    ///
+    ///This performs a linear scan over all entries, so it is not particularly fast.
+    pub fn resolve(&self) -> Option<Entry> {
+        self.pick(entries().filter(|e| self.matches(e)))
+    }
+
+    ///Returns the 0-based index of the referenced [Sense], or `None` if this reference points to
+    ///the whole entry. For example, `引く・1` points to the first sense of 引く, so this returns
+    ///`Some(0)`, whereas `引く` returns `None`.
+    pub fn target_sense(&self) -> Option<usize> {
+        self.sense_number.and_then(|n| n.checked_sub(1))
+    }
+
+    ///Like [CrossReference::resolve()], but also returns the index of the referenced sense within
+    ///the target entry if this reference points to a specific sense (see
+    ///[CrossReference::target_sense()]). This allows quoting only the glosses of that sense:
+    ///
+    ///```
+    ///# use jmdict::CrossReference;
+    ///let xref = CrossReference::parse("お母さん・1");
+    ///if let Some((entry, Some(idx))) = xref.resolve_sense() {
+    ///    let sense = entry.senses().nth(idx).unwrap();
+    ///    println!("see also: {}", sense.glosses().next().unwrap().text);
+    ///}
+    ///```
+    ///
+    ///If the sense number is out of range for the target entry, the entry is returned without a
+    ///sense index. This can happen because senses without glosses in the selected languages are
+    ///not included in the build (see [CrossReference::sense_number]). Note that when such senses
+    ///are dropped from the start of the entry, a sense number may also point to a different sense
+    ///than intended; this cannot be detected.
+    pub fn resolve_sense(&self) -> Option<(Entry, Option<usize>)> {
+        let entry = self.resolve()?;
+        let sense_index = self
+            .target_sense()
+            .filter(|&idx| idx < entry.senses().len());
+        Some((entry, sense_index))
+    }
+
+    pub(crate) fn matches(&self, entry: &Entry) -> bool {
+        match self.reading {
+            Some(reading) => {
+                entry.kanji_elements().any(|k| k.text == self.text)
+                    && entry.reading_elements().any(|r| r.text == reading)
+            }
+            None => {
+                entry.kanji_elements().any(|k| k.text == self.text)
+                    || entry.reading_elements().any(|r| r.text == self.text)
+            }
+        }
+    }
+
+    fn pick(&self, candidates: impl Iterator<Item = Entry>) -> Option<Entry> {
+        let mut result = None;
+        for entry in candidates {
+            let first_text = match entry.kanji_elements().next() {
+                Some(k) => k.text,
+                None => entry.reading_elements().next().unwrap().text,
+            };
+            let is_headword = first_text == self.text
+                || entry.reading_elements().next().map(|r| r.text) == Some(self.text);
+            if is_headword {
+                return Some(entry);
+            }
+            result = result.or(Some(entry));
+        }
+        result
+    }
+}
+
+impl Entry {
+    ///Resolves all cross-references and antonyms in the senses of this entry at once. This is
+    ///intended for code that renders an entry together with its related words, and would
+    ///otherwise call [CrossReference::resolve()] for each reference repeatedly.
+    ///
+    ///The result is the same as from calling [CrossReference::resolve()] on each reference, but
+    ///all references are resolved in a single scan over all entries.
+    pub fn resolve_all(&self) -> ResolvedEntry {
+        let mut refs = Vec::new();
+        for (sense_index, sense) in self.senses().enumerate() {
+            refs.extend(
+                sense
+                    .cross_references()
+                    .map(|r| (sense_index, ReferenceKind::CrossReference, r)),
+            );
+            refs.extend(
+                sense
+                    .antonyms()
+                    .map(|r| (sense_index, ReferenceKind::Antonym, r)),
+            );
+        }
+        let parsed: Vec<_> = refs
+            .iter()
+            .map(|&(_, _, r)| CrossReference::parse(r))
+            .collect();
+
+        let mut candidates = vec![Vec::new(); refs.len()];
+        if !refs.is_empty() {
+            for entry in entries() {
+                for (idx, xref) in parsed.iter().enumerate() {
+                    if xref.matches(&entry) {
+                        candidates[idx].push(entry);
+                    }
+                }
+            }
+        }
+
+        let mut result = ResolvedEntry {
+            entry: *self,
+            cross_references: Vec::new(),
+            antonyms: Vec::new(),
+        };
+        for (((sense_index, kind, _), reference), candidates) in
+            refs.into_iter().zip(parsed).zip(candidates)
+        {
+            let resolved = ResolvedReference {
+                sense_index,
+                reference,
+                target: reference.pick(candidates.into_iter()),
+            };
+            match kind {
+                ReferenceKind::CrossReference => result.cross_references.push(resolved),
+                ReferenceKind::Antonym => result.antonyms.push(resolved),
+            }
+        }
+        result
+    }
+}
+
+///An [Entry] together with the targets of all its cross-references and antonyms. This is
+///returned by [Entry::resolve_all()].
+#[derive(Clone, Debug)]
+pub struct ResolvedEntry {
+    pub entry: Entry,
+    ///The references from [Sense::cross_references()] of all senses, in order.
+    pub cross_references: Vec<ResolvedReference>,
+    ///The references from [Sense::antonyms()] of all senses, in order.
+    pub antonyms: Vec<ResolvedReference>,
+}
+
+impl ResolvedEntry {
+    ///Returns the distinct entries that are referenced by this entry, in order of first
+    ///appearance. Cross-references come before antonyms.
+    pub fn related_entries(&self) -> Vec<Entry> {
+        let mut result: Vec<Entry> = Vec::new();
+        let targets = self.cross_references.iter().chain(&self.antonyms);
+        for target in targets.filter_map(|r| r.target) {
+            if !result.iter().any(|e| e.number == target.number) {
+                result.push(target);
+            }
+        }
+        result
+    }
+}
+
+///A single reference within a [ResolvedEntry].
+#[derive(Clone, Copy, Debug)]
+pub struct ResolvedReference {
+    ///The 0-based index of the [Sense] containing the reference within its [Entry].
+    pub sense_index: usize,
+    pub reference: CrossReference,
+    ///The result of [CrossReference::resolve()].
+    pub target: Option<Entry>,
+}
+
+///Identifies the list that a [BrokenReference] was found in.
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+pub enum ReferenceKind {
+    ///The reference was found in [Sense::cross_references()].
+    CrossReference,
+    ///The reference was found in [Sense::antonyms()].
+    Antonym,
+}
+
+///A reference that could not be resolved. This is returned by [validate_cross_references()].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct BrokenReference {
+    ///The sequence number of the [Entry] containing the reference.
+    pub entry_number: u32,
+    ///The 0-based index of the [Sense] containing the reference within its [Entry].
+    pub sense_index: usize,
+    pub kind: ReferenceKind,
+    ///The reference as it appears in the JMdict.
+    pub target: &'static str,
+}
+
+///Checks all cross-references and antonyms in the database, and reports those that do not
+///resolve to any entry. This is intended for auditing the dataset.
+///
+///Only builds with the `scope-uncommon` feature contain all entries. In other builds, a large
+///number of references will be reported because they point to entries that were not compiled in.
+pub fn validate_cross_references() -> Vec<BrokenReference> {
+    //index all entries by their kanji and reading elements, so that we do not need a full scan for
+    //each reference
+    let mut index: HashMap<&'static str, Vec<Entry>> = HashMap::new();
+    for entry in entries() {
+        let texts = entry
+            .kanji_elements()
+            .map(|k| k.text)
+            .chain(entry.reading_elements().map(|r| r.text));
+        for text in texts {
+            let candidates = index.entry(text).or_default();
+            if candidates.last().map(|e| e.number) != Some(entry.number) {
+                candidates.push(entry);
+            }
+        }
+    }
+
+    let mut result = Vec::new();
+    for entry in entries() {
+        for (sense_index, sense) in entry.senses().enumerate() {
+            let refs = sense
+                .cross_references()
+                .map(|r| (ReferenceKind::CrossReference, r))
+                .chain(sense.antonyms().map(|r| (ReferenceKind::Antonym, r)));
+            for (kind, target) in refs {
+                let xref = CrossReference::parse(target);
+                let is_resolved = index.get(xref.text).map_or(false, |candidates| {
+                    candidates.iter().any(|e| xref.matches(e))
+                });
+                if !is_resolved {
+                    result.push(BrokenReference {
+                        entry_number: entry.number,
+                        sense_index,
+                        kind,
+                        target,
+                    });
+                }
+            }
+        }
+    }
+    result
+}